@@ -0,0 +1,246 @@
+package achievement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// The kinds of rule an achievement can be awarded by
+const (
+	// The player holds at least Threshold medals in a region
+	RuleMedals = "medals"
+	// The player holds Position at least Threshold times in a region
+	RulePositions = "positions"
+	// The player holds Position at least once in at least Threshold regions
+	RuleRegions = "regions"
+	// The player wins back medals on a leaderboard where they were sniped
+	RuleReclaim = "reclaim"
+)
+
+// A rule that awards an achievement when a player's standing meets it
+type Rule struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Position    int    `json:"position"`
+	Threshold   int    `json:"threshold"`
+}
+
+// The rules used when no ACHIEVEMENTS_FILE is configured
+var defaultRules = []Rule{
+	{Id: "first-gold", Name: "First Gold", Description: "Hold a #1", Type: RulePositions, Position: 1, Threshold: 1},
+	{Id: "centurion", Name: "Centurion", Description: "Hold 100 medals in a region", Type: RuleMedals, Threshold: 100},
+	{Id: "world-tour", Name: "World Tour", Description: "Hold a #1 in 10 regions", Type: RuleRegions, Position: 1, Threshold: 10},
+	{Id: "payback", Name: "Payback", Description: "Reclaim medals on a map you were sniped on", Type: RuleReclaim},
+}
+
+var rules []Rule
+var rulesMutex sync.RWMutex
+
+// Load the achievement rules from the ACHIEVEMENTS_FILE, or use the default rules
+//
+// The file should contain a JSON array of rules
+func Initialise() {
+	path := os.Getenv("ACHIEVEMENTS_FILE")
+	if path == "" {
+		setRules(defaultRules)
+		return
+	}
+	loadedRules, err := loadRules(path)
+	if err != nil {
+		log.Printf("error when loading achievements from %s, using the default rules: %s\n", path, err)
+		setRules(defaultRules)
+		return
+	}
+	setRules(loadedRules)
+}
+
+// Read and validate the rules from the provided file
+func loadRules(path string) ([]Rule, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var loadedRules []Rule
+	if err = json.Unmarshal(contents, &loadedRules); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, rule := range loadedRules {
+		if rule.Id == "" || seen[rule.Id] {
+			return nil, fmt.Errorf("rule ids must be present and unique, found %q", rule.Id)
+		}
+		seen[rule.Id] = true
+		switch rule.Type {
+		case RuleMedals, RuleReclaim:
+		case RulePositions, RuleRegions:
+			if rule.Position < 1 || rule.Position > 10 {
+				return nil, fmt.Errorf("rule %s has invalid position %d", rule.Id, rule.Position)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s has unknown type %q", rule.Id, rule.Type)
+		}
+	}
+	return loadedRules, nil
+}
+
+func setRules(newRules []Rule) {
+	rulesMutex.Lock()
+	defer rulesMutex.Unlock()
+	rules = newRules
+}
+
+// Return the rules achievements are currently awarded by
+func GetRules() []Rule {
+	rulesMutex.RLock()
+	defer rulesMutex.RUnlock()
+	return rules
+}
+
+// Evaluate every rule for a player whose standing has just changed, awarding any newly earned achievements
+//
+// The player should reflect the change already being applied. Returns the ids of the awarded achievements.
+func Evaluate(ctx context.Context, player *database.Player, change *database.Change) []string {
+	awarded, err := database.GetAwardedAchievementIds(ctx, player.Platform, player.PlayerId)
+	if err != nil {
+		log.Printf("error when getting achievements for player %s: %s\n", player.PlayerId, err)
+		return nil
+	}
+	var earned []string
+	for _, rule := range GetRules() {
+		if awarded[rule.Id] {
+			continue
+		}
+		met, err := isMet(ctx, rule, player, change)
+		if err != nil {
+			log.Printf("error when evaluating achievement %s for player %s: %s\n", rule.Id, player.PlayerId, err)
+			continue
+		}
+		if met && award(ctx, rule, player, change.Timestamp) {
+			earned = append(earned, rule.Id)
+		}
+	}
+	return earned
+}
+
+// Evaluate every rule against all historic data, such as after a rule has been added
+//
+// Achievements are awarded with the time of the re-evaluation, except for reclaims which use
+// the time of the reclaiming change
+func Reevaluate(ctx context.Context, timestamp int64) {
+	players, err := database.GetTrackStandings(ctx, database.Lifetime)
+	if err != nil {
+		log.Printf("error when getting players to re-evaluate achievements: %s\n", err)
+		return
+	}
+	awardedCount := 0
+	for i := range players {
+		player := &players[i]
+		awarded, err := database.GetAwardedAchievementIds(ctx, player.Platform, player.PlayerId)
+		if err != nil {
+			log.Printf("error when getting achievements for player %s: %s\n", player.PlayerId, err)
+			continue
+		}
+		for _, rule := range GetRules() {
+			if awarded[rule.Id] {
+				continue
+			}
+			// Reclaims happen at a point in time, so look back through the player's changes
+			if rule.Type == RuleReclaim {
+				if reclaim := findReclaim(ctx, player); reclaim != nil && award(ctx, rule, player, reclaim.Timestamp) {
+					awarded[rule.Id] = true
+					awardedCount++
+				}
+				continue
+			}
+			met, err := isMet(ctx, rule, player, &database.Change{Timestamp: timestamp})
+			if err != nil {
+				log.Printf("error when evaluating achievement %s for player %s: %s\n", rule.Id, player.PlayerId, err)
+				continue
+			}
+			if met && award(ctx, rule, player, timestamp) {
+				awarded[rule.Id] = true
+				awardedCount++
+			}
+		}
+	}
+	log.Printf("re-evaluated achievements for %d players, %d achievements awarded", len(players), awardedCount)
+}
+
+// Return whether the player's standing meets the rule
+func isMet(ctx context.Context, rule Rule, player *database.Player, change *database.Change) (bool, error) {
+	switch rule.Type {
+	case RuleMedals:
+		return player.Medals >= rule.Threshold, nil
+	case RulePositions:
+		return player.Positions[strconv.Itoa(rule.Position)] >= rule.Threshold, nil
+	case RuleRegions:
+		regions, err := database.GetPlayerRegions(ctx, database.Lifetime, player.Platform, player.PlayerId)
+		if err != nil {
+			return false, err
+		}
+		held := 0
+		for _, region := range regions {
+			// Global isn't a region of its own
+			if region.Region != database.GlobalRegion && region.Positions[strconv.Itoa(rule.Position)] > 0 {
+				held++
+			}
+		}
+		return held >= rule.Threshold, nil
+	case RuleReclaim:
+		// Only the player's own improvements can reclaim medals
+		if change.MedalChange <= 0 || change.ResponsiblePlayerId != player.PlayerId {
+			return false, nil
+		}
+		return database.WasSniped(ctx, player.Platform, player.Region, player.PlayerId, change.ResponsibleLeaderboardId, change.Timestamp)
+	}
+	return false, nil
+}
+
+// Find the first change where the player reclaimed medals they were sniped for, or nil if there is none
+func findReclaim(ctx context.Context, player *database.Player) *database.Change {
+	gains, err := database.GetPlayerGains(ctx, player.Platform, player.Region, player.PlayerId)
+	if err != nil {
+		log.Printf("error when getting changes for player %s: %s\n", player.PlayerId, err)
+		return nil
+	}
+	for _, gain := range gains {
+		sniped, err := database.WasSniped(ctx, player.Platform, player.Region, player.PlayerId, gain.ResponsibleLeaderboardId, gain.Timestamp)
+		if err != nil {
+			log.Printf("error when checking snipes for player %s: %s\n", player.PlayerId, err)
+			return nil
+		}
+		if sniped {
+			return &gain
+		}
+	}
+	return nil
+}
+
+// Award the achievement for a rule, returning whether it was newly awarded
+func award(ctx context.Context, rule Rule, player *database.Player, timestamp int64) bool {
+	awarded, err := database.AwardAchievement(ctx, database.Achievement{
+		Platform:      player.Platform,
+		PlayerId:      player.PlayerId,
+		AchievementId: rule.Id,
+		Name:          rule.Name,
+		Region:        player.Region,
+		Timestamp:     timestamp,
+	})
+	if err != nil {
+		log.Printf("error when awarding achievement %s to player %s: %s\n", rule.Id, player.PlayerId, err)
+		return false
+	}
+	if awarded {
+		log.Printf("player %s (platform: %d, region: %s) has earned the achievement %s", player.PlayerId, player.Platform, player.Region, rule.Name)
+	}
+	return awarded
+}
@@ -1,151 +1,1012 @@
 package api
 
 import (
+	"context"
+	"log"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"nonetaken.dev/medalsaber/achievement"
 	"nonetaken.dev/medalsaber/database"
+	"nonetaken.dev/medalsaber/dataset"
+	"nonetaken.dev/medalsaber/score"
+	"nonetaken.dev/medalsaber/snapshot"
 )
 
-func Initialise() {
+// A score with the metadata of the leaderboard it was set on
+type ScoreWithLeaderboard struct {
+	database.Score
+	Leaderboard *database.Leaderboard
+}
+
+// A change with the metadata of the leaderboard responsible for it
+type ChangeWithLeaderboard struct {
+	database.Change
+	Leaderboard *database.Leaderboard
+}
+
+// The context the API is served with, cancelled on shutdown, for work that outlives the request starting it
+var serverContext = context.Background()
+
+// Serve the API until ctx is cancelled, then stop accepting requests and wait for those in flight
+//
+// Requests are cancelled along with ctx, so any queries they are waiting on stop too
+func Initialise(ctx context.Context) {
+	serverContext = ctx
 	router := gin.Default()
 
 	// Load routes
 	router.GET("/player/:platform/:region/:playerId", getPlayer)
 	router.GET("/changes/:platform/:region/:playerId", getChanges)
+	router.GET("/rankchanges/:platform/:region/:playerId", getRankChanges)
 	router.GET("/scores/:platform/:scoreId", getScore)
 	router.GET("/scores/:platform/:region/:playerId", getPlayerScores)
 	router.GET("/leaderboard/:platform/:region", getLeaderboard)
+	router.GET("/leaderboards/:platform/:leaderboardId", getLeaderboardMetadata)
+	router.GET("/leaderboards/:platform/:leaderboardId/clans", getMapClans)
+	router.GET("/clans/:platform/:region", getClanLeaderboard)
+	router.GET("/clans/:platform/:region/:clan", getClan)
+	router.GET("/history/:platform/:region/:playerId", getPlayerHistory)
+	router.GET("/movement/:platform/:region", getMovement)
+	router.GET("/progression/:platform/:region/:playerId/:leaderboardId", getProgression)
+	router.GET("/simulate/:platform/:region/:playerId/:leaderboardId", simulateScore)
+	router.GET("/rivals/:platform/:region/:playerId", getRivals)
+	router.GET("/headtohead/:platform/:region/:playerId/:rivalId", getHeadToHead)
+	router.GET("/achievements", getAchievementRules)
+	router.GET("/achievements/:platform/:playerId", getPlayerAchievements)
+	router.GET("/seasons", getSeasons)
+	router.GET("/seasons/:seasonId", getSeason)
+	router.GET("/seasons/:seasonId/leaderboard/:platform/:region", getSeasonLeaderboard)
+	router.GET("/seasons/:seasonId/player/:platform/:region/:playerId", getSeasonPlayer)
+
+	// Load admin routes, these require the ADMIN_TOKEN as a bearer token
+	admin := router.Group("/admin", requireAdmin)
+	admin.POST("/ban/:platform/:playerId", banPlayer)
+	admin.DELETE("/ban/:platform/:playerId", unbanPlayer)
+	admin.DELETE("/scores/:platform/:scoreId", removeScore)
+	admin.POST("/achievements/reevaluate", reevaluateAchievements)
+	admin.POST("/rivals/rebuild", rebuildRivals)
+	admin.GET("/cache", getCacheStats)
+	admin.GET("/export/:kind", exportDataset)
+	admin.POST("/import/:kind", importDataset)
 
 	// Begin the API
-	router.Run("localhost:6969")
+	server := &http.Server{
+		Addr:        "localhost:6969",
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownContext, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownContext); err != nil {
+			log.Printf("error when shutting down the API: %s\n", err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("error when serving the API: %s\n", err)
+	}
 }
 
 func getPlayer(c *gin.Context) {
+	ctx := c.Request.Context()
 	platform, err := strconv.Atoi(c.Param("platform"))
 	// Was a correct platform provided?
 	if err != nil || (platform != 1 && platform != 2) {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
 		return
 	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
 	// Get the player by the platform
-	player, err := database.GetPlayer(platform, c.Param("region"), c.Param("playerId"), "", false)
+	player, err := database.GetPlayer(ctx, track, platform, c.Param("region"), c.Param("playerId"), "", false)
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Player not found"})
 		return
 	}
+	// Work out the player's rank within the region
+	player.MedalRank, err = database.GetMedalRank(ctx, track, platform, player.Region, player.PlayerId, player.Medals)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to rank player"})
+		return
+	}
 	// Return the player
 	c.IndentedJSON(http.StatusOK, player)
 }
 
 func getChanges(c *gin.Context) {
+	ctx := c.Request.Context()
 	// Get the requested platform
 	platform, err := strconv.Atoi(c.Param("platform"))
 	if err != nil || (platform != 1 && platform != 2) {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
 		return
 	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
 	region := c.Param("region")
 	playerId := c.Param("playerId")
-	// Parse optional page param
-	page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid page"})
+	// Parse the optional cursor, limit and total params
+	request, ok := requestedPage(c)
+	if !ok {
+		return
 	}
 	// Parse optional before param
 	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid before"})
+		return
 	}
 	// Parse optional after param
 	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid after"})
+		return
 	}
 	// Fetch the changes
-	changes, err := database.GetChanges(platform, region, playerId, page, before, after)
+	changes, err := database.GetChanges(ctx, track, platform, region, playerId, request, before, after)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Changes not found"})
 		return
 	}
+	// Embed the leaderboard metadata if requested
+	if embedLeaderboards(c) {
+		leaderboardIds := make([]string, 0, len(changes.Items))
+		for _, change := range changes.Items {
+			leaderboardIds = append(leaderboardIds, change.ResponsibleLeaderboardId)
+		}
+		leaderboards, err := database.GetLeaderboards(ctx, platform, leaderboardIds)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to fetch leaderboards"})
+			return
+		}
+		embedded := make([]ChangeWithLeaderboard, 0, len(changes.Items))
+		for _, change := range changes.Items {
+			embedded = append(embedded, ChangeWithLeaderboard{Change: change, Leaderboard: lookupLeaderboard(leaderboards, change.ResponsibleLeaderboardId)})
+		}
+		c.IndentedJSON(http.StatusOK, replaceItems(changes, embedded))
+		return
+	}
 	c.IndentedJSON(http.StatusOK, changes)
 }
 
+func getRankChanges(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	// Parse the optional cursor, limit and total params
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	rankChanges, err := database.GetRankChanges(ctx, platform, c.Param("region"), c.Param("playerId"), request)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Rank changes not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, rankChanges)
+}
+
 func getScore(c *gin.Context) {
+	ctx := c.Request.Context()
 	// Get the requested platform
 	platform, err := strconv.Atoi(c.Param("platform"))
 	if err != nil || (platform != 1 && platform != 2) {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
 		return
 	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
 	scoreId := c.Param("scoreId")
 	// Fetch the score
-	score, err := database.GetScore(platform, scoreId)
+	score, err := database.GetScore(ctx, track, platform, scoreId)
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Score not found"})
 		return
 	}
+	// Embed the leaderboard metadata if requested
+	if embedLeaderboards(c) {
+		embedded := ScoreWithLeaderboard{Score: score}
+		if leaderboard, err := database.GetLeaderboard(ctx, platform, score.LeaderboardId); err == nil {
+			embedded.Leaderboard = &leaderboard
+		}
+		c.IndentedJSON(http.StatusOK, embedded)
+		return
+	}
 	// Return the score
 	c.IndentedJSON(http.StatusOK, score)
 }
 
 func getPlayerScores(c *gin.Context) {
+	ctx := c.Request.Context()
 	// Get the requested platform
 	platform, err := strconv.Atoi(c.Param("platform"))
 	if err != nil || (platform != 1 && platform != 2) {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
 		return
 	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
 	region := c.Param("region")
 	playerId := c.Param("playerId")
-	// Parse optional page param
-	page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
-	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid page"})
+	// Parse the optional cursor, limit and total params
+	request, ok := requestedPage(c)
+	if !ok {
+		return
 	}
 	// Parse optional before param
 	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid before"})
+		return
 	}
 	// Parse optional after param
 	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
 	if err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid after"})
+		return
 	}
 	// Fetch the player's score
-	player, err := database.GetPlayer(platform, region, playerId, "", false)
+	player, err := database.GetPlayer(ctx, track, platform, region, playerId, "", false)
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Player not found"})
 		return
 	}
-	changes, err := database.GetPlayerScores(player, page, before, after)
+	scores, err := database.GetPlayerScores(ctx, track, player, request, before, after)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Scores not found"})
 		return
 	}
-	c.IndentedJSON(http.StatusOK, changes)
+	// Embed the leaderboard metadata if requested
+	if embedLeaderboards(c) {
+		leaderboardIds := make([]string, 0, len(scores.Items))
+		for _, score := range scores.Items {
+			leaderboardIds = append(leaderboardIds, score.LeaderboardId)
+		}
+		leaderboards, err := database.GetLeaderboards(ctx, platform, leaderboardIds)
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to fetch leaderboards"})
+			return
+		}
+		embedded := make([]ScoreWithLeaderboard, 0, len(scores.Items))
+		for _, score := range scores.Items {
+			embedded = append(embedded, ScoreWithLeaderboard{Score: score, Leaderboard: lookupLeaderboard(leaderboards, score.LeaderboardId)})
+		}
+		c.IndentedJSON(http.StatusOK, replaceItems(scores, embedded))
+		return
+	}
+	c.IndentedJSON(http.StatusOK, scores)
 }
 
 func getLeaderboard(c *gin.Context) {
+	ctx := c.Request.Context()
 	// Get the requested platform
 	platform, err := strconv.Atoi(c.Param("platform"))
 	if err != nil || (platform != 1 && platform != 2) {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
 		return
 	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
 	// Fetch the region and page
 	region := c.Param("region")
-	page, err := strconv.Atoi(c.DefaultQuery("page", "0"))
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	// Parse optional sort param
+	sortBy := c.DefaultQuery("sort", database.SortByMedals)
+	if sortBy != database.SortByMedals && sortBy != database.SortByFirsts {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid sort, use medals or firsts"})
+		return
+	}
+	// Fetch the medal holders for the region and page
+	players, err := database.GetTopTenMedalHolders(ctx, track, platform, region, request, sortBy)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
 	if err != nil {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid page"})
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err = database.FillMedalRanks(ctx, track, players.Items); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to rank players"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, players)
+}
+
+func getLeaderboardMetadata(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	leaderboard, err := database.GetLeaderboard(ctx, platform, c.Param("leaderboardId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Leaderboard not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, leaderboard)
+}
+
+func getMapClans(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Clans only exist on BeatLeader
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || platform != 2 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, clans are only available for Beatleader (2)"})
+		return
+	}
+	clans, err := database.GetMapClans(ctx, platform, c.Param("leaderboardId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Clans not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, clans)
+}
+
+func getClanLeaderboard(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Clans only exist on BeatLeader
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || platform != 2 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, clans are only available for Beatleader (2)"})
+		return
+	}
+	// Parse the optional cursor, limit and total params
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	// Parse optional sort param
+	sortBy := c.DefaultQuery("sort", database.SortByMedals)
+	if sortBy != database.SortByMedals && sortBy != database.SortByFirsts {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid sort, use medals or firsts"})
+		return
+	}
+	clans, err := database.GetClanStandings(ctx, platform, c.Param("region"), request, sortBy)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
 	}
-	// Fetch the top 10 medal holders for the region and page
-	players, err := database.GetTopTenMedalHolders(platform, region, int64(page))
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
 	}
+	c.IndentedJSON(http.StatusOK, clans)
+}
+
+func getClan(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Clans only exist on BeatLeader
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || platform != 2 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, clans are only available for Beatleader (2)"})
+		return
+	}
+	region := c.Param("region")
+	clan := c.Param("clan")
+	// Parse the optional cursor, limit and total params for the members
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	standing, err := database.GetClanStanding(ctx, platform, region, clan)
+	if err != nil || standing.Members == 0 {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Clan not found"})
+		return
+	}
+	members, err := database.GetClanMembers(ctx, platform, region, clan, request)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Clan not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"clan":    standing,
+		"members": members,
+	})
+}
+
+func getPlayerHistory(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	// Parse optional before param
+	before, err := strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid before"})
+		return
+	}
+	// Parse optional after param
+	after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid after"})
+		return
+	}
+	// Fetch the player's rank and medals over time
+	history, err := database.GetPlayerHistory(ctx, platform, c.Param("region"), c.Param("playerId"), before, after)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "History not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, history)
+}
+
+func getMovement(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	region := c.Param("region")
+	// Parse the from param, the snapshot to compare against
+	from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid from"})
+		return
+	}
+	// Parse optional to param, defaulting to the latest snapshot
+	to, err := strconv.ParseInt(c.DefaultQuery("to", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid to"})
+		return
+	}
+	fromSnapshot, err := database.GetSnapshotAt(ctx, platform, region, from)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Snapshot not found"})
+		return
+	}
+	toSnapshot, err := database.GetSnapshotAt(ctx, platform, region, to)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Snapshot not found"})
+		return
+	}
+	climbers, fallers := snapshot.CompareSnapshots(fromSnapshot, toSnapshot)
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"from":     fromSnapshot.Timestamp,
+		"to":       toSnapshot.Timestamp,
+		"climbers": climbers,
+		"fallers":  fallers,
+	})
+}
+
+func getProgression(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	region := c.Param("region")
+	playerId := c.Param("playerId")
+	leaderboardId := c.Param("leaderboardId")
+	// Parse the optional cursor, limit and total params for the previous bests
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	// Fetch the player's previous bests
+	history, err := database.GetScoreHistory(ctx, platform, region, playerId, leaderboardId, request)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Score history not found"})
+		return
+	}
+	// Find the player's current best, if it is still tracked
+	standings, err := database.GetStandings(ctx, database.Lifetime, platform, region, leaderboardId, int64(score.TrackedPositions()))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Scores not found"})
+		return
+	}
+	var current *database.ArchivedScore
+	for _, standing := range standings {
+		if standing.PlayerId == playerId {
+			trackedScore, err := database.GetScore(ctx, database.Lifetime, platform, standing.ScoreId)
+			if err != nil {
+				c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Score not found"})
+				return
+			}
+			current = &database.ArchivedScore{
+				Score:    trackedScore,
+				Region:   region,
+				Position: standing.Position,
+				Medals:   score.MedalValues[standing.Position-1],
+			}
+			break
+		}
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"history": history,
+		"current": current,
+	})
+}
+
+func simulateScore(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
+	// Parse the hypothetical score
+	value, err := strconv.Atoi(c.Query("score"))
+	if err != nil || value < 0 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid score"})
+		return
+	}
+	simulation, err := score.SimulateScore(ctx, track, platform, c.Param("leaderboardId"), c.Param("region"), c.Param("playerId"), value)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to simulate score"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, simulation)
+}
+
+func getRivals(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	region := c.Param("region")
+	playerId := c.Param("playerId")
+	// Parse the optional limit and total params, each list is paged with its own cursor
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	snipedByRequest, snipedRequest := request, request
+	snipedByRequest.Cursor = c.Query("snipedByCursor")
+	snipedRequest.Cursor = c.Query("snipedCursor")
+	// Who has sniped the player the most
+	snipedBy, err := database.GetSnipedBy(ctx, platform, region, playerId, snipedByRequest)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid snipedByCursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Rivals not found"})
+		return
+	}
+	// And who the player has sniped the most
+	sniped, err := database.GetSniped(ctx, platform, region, playerId, snipedRequest)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid snipedCursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Rivals not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"snipedBy": snipedBy,
+		"sniped":   sniped,
+	})
+}
+
+func getHeadToHead(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	headToHead, err := database.GetHeadToHead(ctx, platform, c.Param("region"), c.Param("playerId"), c.Param("rivalId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Head to head not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, headToHead)
+}
+
+func getAchievementRules(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, achievement.GetRules())
+}
+
+func getPlayerAchievements(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	// Parse the optional cursor, limit and total params
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	achievements, err := database.GetPlayerAchievements(ctx, platform, c.Param("playerId"), request)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Achievements not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, achievements)
+}
+
+func getSeasons(c *gin.Context) {
+	ctx := c.Request.Context()
+	seasons, err := database.GetSeasons(ctx)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to fetch seasons"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, seasons)
+}
+
+func getSeason(c *gin.Context) {
+	ctx := c.Request.Context()
+	season, err := database.GetSeason(ctx, c.Param("seasonId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Season not found"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, season)
+}
+
+func getSeasonLeaderboard(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	season, err := database.GetSeason(ctx, c.Param("seasonId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Season not found"})
+		return
+	}
+	// Fetch the region and page
+	region := c.Param("region")
+	request, ok := requestedPage(c)
+	if !ok {
+		return
+	}
+	// Finished seasons are served from their archived final standings
+	if season.Archived {
+		standings, err := database.GetSeasonStandings(ctx, season.SeasonId, platform, region, request)
+		if err == database.ErrInvalidCursor {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+			return
+		}
+		if err != nil {
+			c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.IndentedJSON(http.StatusOK, standings)
+		return
+	}
+	players, err := database.GetTopTenMedalHolders(ctx, season.GetTrack(), platform, region, request, database.SortByMedals)
+	if err == database.ErrInvalidCursor {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err = database.FillMedalRanks(ctx, season.GetTrack(), players.Items); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to rank players"})
+		return
+	}
 	c.IndentedJSON(http.StatusOK, players)
 }
+
+func getSeasonPlayer(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	season, err := database.GetSeason(ctx, c.Param("seasonId"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Season not found"})
+		return
+	}
+	player, err := database.GetPlayer(ctx, season.GetTrack(), platform, c.Param("region"), c.Param("playerId"), "", false)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Player not found"})
+		return
+	}
+	player.MedalRank, err = database.GetMedalRank(ctx, season.GetTrack(), platform, player.Region, player.PlayerId, player.Medals)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to rank player"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, player)
+}
+
+// Return the track selected by the optional track or mode param, writing an error response if it isn't active
+//
+// Defaults to the lifetime track, derived tracks such as fullcombo and game modes such as OneSaber
+// can be selected once enabled
+func requestedTrack(c *gin.Context) (*database.Track, bool) {
+	name := c.DefaultQuery("track", database.LifetimeTrack)
+	if mode := c.Query("mode"); mode != "" {
+		if c.Query("track") != "" {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Use either track or mode, not both"})
+			return nil, false
+		}
+		name = score.ModeTrackName(mode)
+	}
+	track := score.LookupTrack(name)
+	if track == nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Track not found"})
+		return nil, false
+	}
+	return track, true
+}
+
+// Return the page selected by the optional cursor, limit and total params, writing an error response if they are invalid
+//
+// The cursor should be the next or prev cursor of a previous page, with the same filters and sort
+func requestedPage(c *gin.Context) (database.PageRequest, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(database.DefaultPageLimit)))
+	if err != nil || limit < 1 || limit > database.MaxPageLimit {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid limit, use between 1 and " + strconv.Itoa(database.MaxPageLimit)})
+		return database.PageRequest{}, false
+	}
+	includeTotal, err := strconv.ParseBool(c.DefaultQuery("total", "false"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid total"})
+		return database.PageRequest{}, false
+	}
+	return database.PageRequest{
+		Cursor:       c.Query("cursor"),
+		Limit:        limit,
+		IncludeTotal: includeTotal,
+	}, true
+}
+
+// Return a page holding the provided items in place of its own, such as with embedded metadata
+func replaceItems[T any, U any](page database.Page[T], items []U) database.Page[U] {
+	return database.Page[U]{
+		Items: items,
+		Next:  page.Next,
+		Prev:  page.Prev,
+		Total: page.Total,
+	}
+}
+
+// Return whether the request asked for leaderboard metadata to be embedded
+func embedLeaderboards(c *gin.Context) bool {
+	return c.Query("embed") == "leaderboard"
+}
+
+// Return the leaderboard with the provided id, or nil if it has no stored metadata
+func lookupLeaderboard(leaderboards map[string]database.Leaderboard, leaderboardId string) *database.Leaderboard {
+	leaderboard, ok := leaderboards[leaderboardId]
+	if !ok {
+		return nil
+	}
+	return &leaderboard
+}
+
+// Reject any request that doesn't carry the admin token
+func requireAdmin(c *gin.Context) {
+	token := os.Getenv("ADMIN_TOKEN")
+	// Admin routes are disabled entirely if no token is configured
+	if token == "" || c.GetHeader("Authorization") != "Bearer "+token {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+		return
+	}
+	c.Next()
+}
+
+func banPlayer(c *gin.Context) {
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	// Ban the player, removing their scores and redistributing their medals. This runs under the server's
+	// context, as a client disconnecting partway would otherwise leave the cleanup unfinished
+	if err = score.BanPlayer(serverContext, platform, c.Param("playerId"), c.Query("reason")); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Player banned"})
+}
+
+func unbanPlayer(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	if err = score.UnbanPlayer(ctx, platform, c.Param("playerId")); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Player unbanned"})
+}
+
+func removeScore(c *gin.Context) {
+	ctx := c.Request.Context()
+	// Get the requested platform
+	platform, err := strconv.Atoi(c.Param("platform"))
+	if err != nil || (platform != 1 && platform != 2) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+		return
+	}
+	// Remove the score, promoting everyone below it
+	err = score.RemoveScore(ctx, platform, c.Param("scoreId"))
+	if err == database.ErrNotFound {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Score not found"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": "Failed to remove score"})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Score removed"})
+}
+
+func reevaluateAchievements(c *gin.Context) {
+	if !database.MongoEnabled() {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": database.ErrMongoDisabled.Error()})
+		return
+	}
+	// Re-evaluating can take a while, so run it in the background, where it must outlive the request
+	go achievement.Reevaluate(serverContext, time.Now().UnixMilli())
+	c.IndentedJSON(http.StatusAccepted, gin.H{"message": "Achievement re-evaluation started"})
+}
+
+func rebuildRivals(c *gin.Context) {
+	ctx := c.Request.Context()
+	err := database.RebuildRivalries(ctx)
+	if err == database.ErrRivalriesCompacted {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Rivals rebuilt"})
+}
+
+func getCacheStats(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, database.GetStandingsCacheStats())
+}
+
+func exportDataset(c *gin.Context) {
+	ctx := c.Request.Context()
+	kind := c.Param("kind")
+	format := c.DefaultQuery("format", dataset.FormatNdjson)
+	contentType, ok := dataset.ContentTypes[format]
+	if !ok {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": dataset.ErrUnknownFormat.Error()})
+		return
+	}
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
+	filter := database.ExportFilter{Region: c.Query("region")}
+	// Parse optional platform param
+	if c.Query("platform") != "" {
+		platform, err := strconv.Atoi(c.Query("platform"))
+		if err != nil || (platform != 1 && platform != 2) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid platform, use 1 for ScoreSaber or 2 for Beatleader"})
+			return
+		}
+		filter.Platform = platform
+	}
+	// Parse optional before param
+	var err error
+	filter.Before, err = strconv.ParseInt(c.DefaultQuery("before", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid before"})
+		return
+	}
+	// Parse optional after param
+	filter.After, err = strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid after"})
+		return
+	}
+	switch kind {
+	case dataset.KindPlayers, dataset.KindScores, dataset.KindChanges, dataset.KindStandings, dataset.KindLeaderboards:
+	default:
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": dataset.ErrUnknownKind.Error()})
+		return
+	}
+	// Stream the records, once they've started the status can no longer change so errors are only logged
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename="+kind+"."+format)
+	c.Status(http.StatusOK)
+	if _, err = dataset.Export(ctx, track, kind, format, filter, c.Writer); err != nil {
+		log.Printf("error when exporting %s: %s\n", kind, err)
+	}
+}
+
+func importDataset(c *gin.Context) {
+	ctx := c.Request.Context()
+	kind := c.Param("kind")
+	// Get the requested track
+	track, ok := requestedTrack(c)
+	if !ok {
+		return
+	}
+	imported, err := dataset.Import(ctx, track, kind, c.DefaultQuery("format", dataset.FormatNdjson), c.Request.Body)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error(), "imported": imported})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "Imported " + strconv.Itoa(imported) + " " + kind})
+}
@@ -2,33 +2,104 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"nonetaken.dev/medalsaber/achievement"
 	"nonetaken.dev/medalsaber/api"
 	"nonetaken.dev/medalsaber/database"
+	"nonetaken.dev/medalsaber/dataset"
+	"nonetaken.dev/medalsaber/score"
+	"nonetaken.dev/medalsaber/snapshot"
 	"nonetaken.dev/medalsaber/websocket"
 )
 
 func main() {
 	godotenv.Load("../.env")
+	// Cancel everything in flight when asked to stop, such as by Ctrl+C or the container stopping
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	// Initialise the database handler
-	database.Initialise()
+	database.Initialise(ctx)
+
+	// Export or import records through stdout or stdin and exit, nothing else is printed so the output can be piped
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		if err := runDataset(ctx, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("%s failed: %s\n", os.Args[1], err)
+		}
+		return
+	}
 	fmt.Println("Database initialised")
 
+	// Load the achievement rules
+	achievement.Initialise()
+	fmt.Println("Achievements initialised")
+
+	// Begin running seasons, if enabled
+	score.InitialiseSeasons(ctx)
+	fmt.Println("Seasons initialised")
+
+	// Begin rolling up old changes, if enabled
+	score.InitialiseRetention(ctx)
+	fmt.Println("Retention initialised")
+
+	// Begin taking standings snapshots
+	snapshot.Initialise(ctx)
+	fmt.Println("Snapshots initialised")
+
 	// Initialise the websocket handler
-	websocket.Initialise()
+	websocket.Initialise(ctx)
 	fmt.Println("Websocket handler initialised")
 
-	api.Initialise()
-	fmt.Println("API initialised")
-
 	// Define a defer function to handle the client disconnecting
 	defer func() {
-		if err := database.Client.Disconnect(context.TODO()); err != nil {
+		disconnectContext, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if database.Client == nil {
+			return
+		}
+		if err := database.Client.Disconnect(disconnectContext); err != nil {
 			panic(err)
 		}
 	}()
 
-	select {}
+	// Serve the API until asked to stop
+	fmt.Println("API initialised")
+	api.Initialise(ctx)
+	fmt.Println("Shutting down")
+}
+
+// Run the export or import command, export [-format] [-track] [-platform] [-region] [-after] [-before] <kind>
+// or import [-format] [-track] <kind>
+func runDataset(ctx context.Context, command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	format := flags.String("format", dataset.FormatNdjson, "ndjson or csv")
+	trackName := flags.String("track", database.LifetimeTrack, "the track to read or write")
+	var filter database.ExportFilter
+	if command == "export" {
+		flags.IntVar(&filter.Platform, "platform", 0, "only export records of this platform, 1 or 2")
+		flags.StringVar(&filter.Region, "region", "", "only export records of this region")
+		flags.Int64Var(&filter.After, "after", 0, "only export scores, changes and standings from this timestamp")
+		flags.Int64Var(&filter.Before, "before", 0, "only export scores, changes and standings up to this timestamp")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("expected the kind of record, players, scores, changes, standings or leaderboards")
+	}
+	track := database.GetTrack(*trackName)
+	if command == "export" {
+		count, err := dataset.Export(ctx, track, flags.Arg(0), *format, filter, os.Stdout)
+		log.Printf("exported %d %s\n", count, flags.Arg(0))
+		return err
+	}
+	count, err := dataset.Import(ctx, track, flags.Arg(0), *format, os.Stdin)
+	log.Printf("imported %d %s\n", count, flags.Arg(0))
+	return err
 }
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Fetch an integer from the environment, falling back to the default if it is unset or invalid
+func GetInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid value %q for %s, using default %d\n", value, name, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// Fetch a duration (such as "24h") from the environment, falling back to the default if it is unset or invalid
+func GetDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid value %q for %s, using default %s\n", value, name, fallback)
+		return fallback
+	}
+	return parsed
+}
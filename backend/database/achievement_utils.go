@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Fetch a page of the achievements awarded to a player, oldest first
+func GetPlayerAchievements(ctx context.Context, platform int, playerId string, request PageRequest) (Page[Achievement], error) {
+	return fetchPage(ctx, Collections.Achievements, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	}, request, achievementSort, func(achievement Achievement) []any {
+		return []any{achievement.Timestamp, achievement.AchievementId}
+	})
+}
+
+// Fetch the ids of every achievement awarded to a player
+func GetAwardedAchievementIds(ctx context.Context, platform int, playerId string) (map[string]bool, error) {
+	var achievements []Achievement
+	if err := FetchDocuments(ctx, Collections.Achievements, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	}, &achievements, options.Find().SetProjection(bson.M{"achievementId": 1})); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]bool, len(achievements))
+	for _, achievement := range achievements {
+		ids[achievement.AchievementId] = true
+	}
+	return ids, nil
+}
+
+// Award an achievement, returning whether the player didn't already have it
+func AwardAchievement(ctx context.Context, achievement Achievement) (bool, error) {
+	return InsertDocumentIfAbsent(ctx, Collections.Achievements, bson.M{
+		"platform":      achievement.Platform,
+		"playerId":      achievement.PlayerId,
+		"achievementId": achievement.AchievementId,
+	}, achievement)
+}
+
+// Return whether the player lost medals on a leaderboard to another player before the timestamp
+func WasSniped(ctx context.Context, platform int, region string, playerId string, leaderboardId string, before int64) (bool, error) {
+	return store.WasSniped(ctx, Lifetime, platform, region, playerId, leaderboardId, before)
+}
+
+// Fetch every change where the player gained medals from their own score, oldest first
+func GetPlayerGains(ctx context.Context, platform int, region string, playerId string) ([]Change, error) {
+	return store.GetPlayerGains(ctx, Lifetime, platform, region, playerId)
+}
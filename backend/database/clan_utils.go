@@ -0,0 +1,78 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Record the player now holding first place on a leaderboard in a region
+func SetMapLeader(ctx context.Context, leader MapLeader) error {
+	return UpsertDocument(ctx, Collections.MapLeaders, bson.M{
+		"platform":      leader.Platform,
+		"leaderboardId": leader.LeaderboardId,
+		"region":        leader.Region,
+	}, bson.M{"$set": bson.M{
+		"playerId":  leader.PlayerId,
+		"timestamp": leader.Timestamp,
+	}})
+}
+
+// Remove the player as the holder of first place on a leaderboard in a region, if they still hold it
+func RemoveMapLeader(ctx context.Context, platform int, leaderboardId string, region string, playerId string) error {
+	return DeleteManyDocuments(ctx, Collections.MapLeaders, bson.M{
+		"platform":      platform,
+		"leaderboardId": leaderboardId,
+		"region":        region,
+		"playerId":      playerId,
+	})
+}
+
+// Fetch a page of the clans ordered by the combined lifetime medals of their members in a region
+func GetClanStandings(ctx context.Context, platform int, region string, request PageRequest, sortBy string) (Page[ClanStanding], error) {
+	return store.GetClanStandings(ctx, Lifetime, platform, region, request, sortBy)
+}
+
+// Fetch the combined standing of a single clan in a region
+func GetClanStanding(ctx context.Context, platform int, region string, clan string) (ClanStanding, error) {
+	return store.GetClanStanding(ctx, Lifetime, platform, region, clan)
+}
+
+// Fetch a page of the members of a clan holding medals in a region, ordered by medals
+func GetClanMembers(ctx context.Context, platform int, region string, clan string, request PageRequest) (Page[Player], error) {
+	return store.GetClanMembers(ctx, Lifetime, platform, region, clan, request)
+}
+
+// Fetch the clans holding first place on a leaderboard, ordered by how many regions they hold it in
+//
+// Players are counted towards the clan they are in now, rather than when they took first place
+func GetMapClans(ctx context.Context, platform int, leaderboardId string) ([]MapClan, error) {
+	var leaders []MapLeader
+	if err := FetchDocuments(ctx, Collections.MapLeaders, bson.M{"platform": platform, "leaderboardId": leaderboardId}, &leaders); err != nil {
+		return []MapClan{}, err
+	}
+	playerIds := make([]string, 0, len(leaders))
+	for _, leader := range leaders {
+		playerIds = append(playerIds, leader.PlayerId)
+	}
+	clansByPlayer, err := store.GetPlayerClans(ctx, Lifetime, platform, playerIds)
+	if err != nil {
+		return []MapClan{}, err
+	}
+	firsts := make(map[string]int)
+	for _, leader := range leaders {
+		if clan := clansByPlayer[leader.PlayerId]; clan != "" {
+			firsts[clan]++
+		}
+	}
+	clans := make([]MapClan, 0, len(firsts))
+	for clan, count := range firsts {
+		clans = append(clans, MapClan{Clan: clan, Firsts: count})
+	}
+	slices.SortFunc(clans, func(a, b MapClan) int {
+		return cmp.Or(cmp.Compare(b.Firsts, a.Firsts), cmp.Compare(a.Clan, b.Clan))
+	})
+	return clans, nil
+}
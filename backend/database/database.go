@@ -2,71 +2,190 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"nonetaken.dev/medalsaber/config"
 )
 
 var Collections collections
 var Client *mongo.Client
+var Database *mongo.Database
+
+// The context of the whole process, cancelled on shutdown, for work that isn't started by a caller
+var processContext = context.Background()
+
+// How long each kind of operation may run before it is abandoned, on top of any deadline set by the caller
+var timeouts struct {
+	read      time.Duration
+	write     time.Duration
+	aggregate time.Duration
+	migration time.Duration
+}
 
 type collections struct {
-	Players *mongo.Collection
-	Scores  *mongo.Collection
-	Changes *mongo.Collection
+	Players         *mongo.Collection
+	Scores          *mongo.Collection
+	Standings       *mongo.Collection
+	Changes         *mongo.Collection
+	Bans            *mongo.Collection
+	Leaderboards    *mongo.Collection
+	Seasons         *mongo.Collection
+	SeasonStandings *mongo.Collection
+	Snapshots       *mongo.Collection
+	Achievements    *mongo.Collection
+	Rivalries       *mongo.Collection
+	ScoreHistory    *mongo.Collection
+	RankChanges     *mongo.Collection
+	MapLeaders      *mongo.Collection
+	Migrations      *mongo.Collection
 }
 
 // Initialise the database connection and fetch the collections
-func Initialise() {
+//
+// Timeouts can be set with DATABASE_READ_TIMEOUT, DATABASE_WRITE_TIMEOUT, DATABASE_AGGREGATE_TIMEOUT
+// and DATABASE_MIGRATION_TIMEOUT (such as "30s"). Migrations and index creation stop if ctx is cancelled.
+func Initialise(ctx context.Context) {
+	processContext = ctx
+	timeouts.read = config.GetDuration("DATABASE_READ_TIMEOUT", 10*time.Second)
+	timeouts.write = config.GetDuration("DATABASE_WRITE_TIMEOUT", 10*time.Second)
+	timeouts.aggregate = config.GetDuration("DATABASE_AGGREGATE_TIMEOUT", 30*time.Second)
+	timeouts.migration = config.GetDuration("DATABASE_MIGRATION_TIMEOUT", 5*time.Minute)
+	reservePositions = max(config.GetInt("RESERVE_POSITIONS", 10), 0)
 	databaseURI := os.Getenv("MONGO_URI")
 	if databaseURI == "" {
-		log.Fatal("Missing MONGO_URI environment variable")
+		// The SQLite store can run on its own, without the features kept in MongoDB
+		if os.Getenv("DATABASE_BACKEND") != SqliteBackend {
+			log.Fatal("Missing MONGO_URI environment variable")
+		}
+		log.Println("MONGO_URI is unset, running without the features kept in MongoDB such as bans, seasons and achievements")
+		Lifetime = &Track{Name: LifetimeTrack}
+		initialiseStore(ctx)
+		initialiseCache(ctx)
+		return
 	}
 	client, err := mongo.Connect(options.Client().ApplyURI(databaseURI))
 	if err != nil {
 		panic(err)
 	}
 	Client = client
-	databaseName := os.Getenv("MONGO_DATABASE")
+	Database = client.Database(os.Getenv("MONGO_DATABASE"))
 	// Set the collections within the collections struct
 	collections := collections{
-		Players: client.Database(databaseName).Collection("players"),
-		Scores:  client.Database(databaseName).Collection("scores"),
-		Changes: client.Database(databaseName).Collection("changes"),
+		Players:         Database.Collection("players"),
+		Scores:          Database.Collection("scores"),
+		Standings:       Database.Collection("standings"),
+		Changes:         Database.Collection("changes"),
+		Bans:            Database.Collection("bans"),
+		Leaderboards:    Database.Collection("leaderboards"),
+		Seasons:         Database.Collection("seasons"),
+		SeasonStandings: Database.Collection("seasonStandings"),
+		Snapshots:       Database.Collection("snapshots"),
+		Achievements:    Database.Collection("achievements"),
+		Rivalries:       Database.Collection("rivalries"),
+		ScoreHistory:    Database.Collection("scoreHistory"),
+		RankChanges:     Database.Collection("rankChanges"),
+		MapLeaders:      Database.Collection("mapLeaders"),
+		Migrations:      Database.Collection("migrations"),
 	}
 	Collections = collections
+	// The lifetime standings live in the main collections
+	Lifetime = &Track{
+		Name:      LifetimeTrack,
+		Scores:    collections.Scores,
+		Standings: collections.Standings,
+		Players:   collections.Players,
+		Changes:   collections.Changes,
+	}
+	// Open the store the standings are kept in
+	initialiseStore(ctx)
+	// Bring the stored documents up to date before relying on them, such as for unique indexes
+	runMigrations(ctx)
+	createIndexes(ctx)
+	initialiseCache(ctx)
+}
+
+// Returned by operations that need MongoDB when it isn't configured
+var ErrMongoDisabled = errors.New("MongoDB isn't configured, set MONGO_URI to enable this")
+
+// Return whether MongoDB is configured, it is optional with the SQLite store
+//
+// Without it the collections are nil. The document helpers below then find nothing when reading and
+// drop writes, so the engine can run with the features kept in MongoDB switched off.
+func MongoEnabled() bool {
+	return Database != nil
 }
 
 // Fetch a document from the provided collection using the provided filter
-func FetchDocument(collection *mongo.Collection, filter bson.M) (*mongo.SingleResult, error) {
-	context, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func FetchDocument(ctx context.Context, collection *mongo.Collection, filter bson.M, options ...options.Lister[options.FindOneOptions]) (*mongo.SingleResult, error) {
+	if collection == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
 	defer cancel()
-	result := collection.FindOne(context, filter)
+	result := collection.FindOne(ctx, filter, options...)
 	if result.Err() != nil {
 		return nil, result.Err()
 	}
 	return result, nil
 }
 
-// Fetch multiple documents from the provided collection using the provided filter, skip and limit
-func FetchDocuments(collection *mongo.Collection, filter bson.M, options ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
-	context, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Fetch multiple documents from the provided collection using the provided filter, decoding them into results
+//
+// The results should be a pointer to a slice
+func FetchDocuments(ctx context.Context, collection *mongo.Collection, filter bson.M, results any, options ...options.Lister[options.FindOptions]) error {
+	if collection == nil {
+		return emptyResults(results)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	cursor, err := collection.Find(ctx, filter, options...)
+	if err != nil {
+		return err
+	}
+	// Decode within the same deadline, so a slow cursor can't outlive the query
+	return cursor.All(ctx, results)
+}
+
+// Count the documents in the provided collection matching the filter
+func CountDocuments(ctx context.Context, collection *mongo.Collection, filter bson.M) (int64, error) {
+	if collection == nil {
+		return 0, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
 	defer cancel()
-	return collection.Find(
-		context,
-		filter,
-		options...,
-	)
+	return collection.CountDocuments(ctx, filter)
+}
+
+// Run an aggregation pipeline against the provided collection, decoding the output into results
+//
+// The results should be a pointer to a slice
+func AggregateDocuments(ctx context.Context, collection *mongo.Collection, pipeline any, results any) error {
+	if collection == nil {
+		return emptyResults(results)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.aggregate)
+	defer cancel()
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, results)
 }
 
 // Insert a document into the provided collection
-func InsertDocument(collection *mongo.Collection, document interface{}) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func InsertDocument(ctx context.Context, collection *mongo.Collection, document interface{}) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
 	defer cancel()
 	_, err := collection.InsertOne(ctx, document)
 	if err != nil {
@@ -75,9 +194,26 @@ func InsertDocument(collection *mongo.Collection, document interface{}) error {
 	return nil
 }
 
+// Insert multiple documents into the provided collection
+func InsertManyDocuments(ctx context.Context, collection *mongo.Collection, documents []any) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := collection.InsertMany(ctx, documents)
+	if err != nil {
+		return fmt.Errorf("error inserting documents: %v", err)
+	}
+	return nil
+}
+
 // Delete the provided document
-func DeleteDocument(collection *mongo.Collection, filter bson.M) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func DeleteDocument(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
 	defer cancel()
 	_, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
@@ -87,8 +223,11 @@ func DeleteDocument(collection *mongo.Collection, filter bson.M) error {
 }
 
 // Update the provided document
-func UpdateDocument(collection *mongo.Collection, filter bson.M, update bson.M) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func UpdateDocument(ctx context.Context, collection *mongo.Collection, filter bson.M, update bson.M) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
 	defer cancel()
 	_, err := collection.UpdateOne(ctx, filter, update)
 	if err != nil {
@@ -97,9 +236,54 @@ func UpdateDocument(collection *mongo.Collection, filter bson.M, update bson.M)
 	return nil
 }
 
-// Update multiple documents matching the filter
-func UpdateManyDocuments(collection *mongo.Collection, filter bson.M, update bson.M) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+// Delete all documents matching the filter
+func DeleteManyDocuments(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("error deleting documents: %v", err)
+	}
+	return nil
+}
+
+// Update the provided document, creating it if it doesn't exist
+func UpsertDocument(ctx context.Context, collection *mongo.Collection, filter bson.M, update bson.M) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := collection.UpdateOne(ctx, filter, update, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error upserting document: %w", err)
+	}
+	return nil
+}
+
+// Insert the document only if no document matches the filter, returning whether it was inserted
+func InsertDocumentIfAbsent(ctx context.Context, collection *mongo.Collection, filter bson.M, document any) (bool, error) {
+	if collection == nil {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$setOnInsert": document}, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return false, fmt.Errorf("error inserting document: %w", err)
+	}
+	return result.UpsertedCount > 0, nil
+}
+
+// Update multiple documents matching the filter, the update is either a document or an aggregation pipeline
+func UpdateManyDocuments(ctx context.Context, collection *mongo.Collection, filter bson.M, update any) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
 	defer cancel()
 	_, err := collection.UpdateMany(ctx, filter, update)
 	if err != nil {
@@ -107,3 +291,24 @@ func UpdateManyDocuments(collection *mongo.Collection, filter bson.M, update bso
 	}
 	return nil
 }
+
+// Perform multiple writes against the provided collection in a single round-trip, in order
+func BulkWriteDocuments(ctx context.Context, collection *mongo.Collection, models []mongo.WriteModel) error {
+	if collection == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := collection.BulkWrite(ctx, models)
+	if err != nil {
+		return fmt.Errorf("error writing documents: %w", err)
+	}
+	return nil
+}
+
+// Set the results of a read from a collection that isn't configured to an empty slice
+func emptyResults(results any) error {
+	slice := reflect.ValueOf(results).Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	return nil
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// The number of records read or written at once when exporting and importing
+const transferBatchSize = 500
+
+// Limits the records that are exported, zero values match everything
+type ExportFilter struct {
+	Platform int
+	// Only players, changes and standings have a region, scores are matched by the regions they stand in
+	Region string
+	// Inclusive bounds on the timestamps of scores, changes and standings
+	After  int64
+	Before int64
+}
+
+// Add the platform and timestamp conditions of the export filter to a query
+func (filter ExportFilter) match(withRegion bool, withTimestamp bool) bson.M {
+	match := bson.M{}
+	if filter.Platform != 0 {
+		match["platform"] = filter.Platform
+	}
+	if withRegion && filter.Region != "" {
+		match["region"] = filter.Region
+	}
+	if withTimestamp && (filter.After != 0 || filter.Before != 0) {
+		timestamp := bson.M{}
+		if filter.After != 0 {
+			timestamp["$gte"] = filter.After
+		}
+		if filter.Before != 0 {
+			timestamp["$lte"] = filter.Before
+		}
+		match["timestamp"] = timestamp
+	}
+	return match
+}
+
+// Call fn with each result of the pipeline in turn, stopping at the first error
+//
+// The results are streamed rather than loaded together. Exports walk whole collections, so they are
+// given as long as a migration.
+func eachDocument[T any](ctx context.Context, collection *mongo.Collection, pipeline bson.A, fn func(T) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.migration)
+	defer cancel()
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var document T
+		if err = cursor.Decode(&document); err != nil {
+			return err
+		}
+		if err = fn(document); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// Replace documents by their unique keys in batches, creating any that don't exist
+//
+// Importing the same documents again leaves them unchanged
+func replaceDocuments[T any](ctx context.Context, collection *mongo.Collection, documents []T, keyOf func(T) bson.M) error {
+	for start := 0; start < len(documents); start += transferBatchSize {
+		batch := documents[start:min(start+transferBatchSize, len(documents))]
+		models := make([]mongo.WriteModel, 0, len(batch))
+		for _, document := range batch {
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(keyOf(document)).SetReplacement(document).SetUpsert(true))
+		}
+		if err := BulkWriteDocuments(ctx, collection, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call fn with the metadata of each leaderboard matching the filter
+//
+// Leaderboards have no region or timestamp, so only the platform is filtered on
+func EachLeaderboard(ctx context.Context, filter ExportFilter, fn func(Leaderboard) error) error {
+	if !MongoEnabled() {
+		return ErrMongoDisabled
+	}
+	return eachDocument(ctx, Collections.Leaderboards, bson.A{bson.M{"$match": filter.match(false, false)}}, fn)
+}
+
+// Store the metadata of leaderboards, replacing any already stored
+func UpsertLeaderboards(ctx context.Context, leaderboards []Leaderboard) error {
+	if !MongoEnabled() {
+		return ErrMongoDisabled
+	}
+	return replaceDocuments(ctx, Collections.Leaderboards, leaderboards, func(leaderboard Leaderboard) bson.M {
+		return bson.M{"platform": leaderboard.Platform, "leaderboardId": leaderboard.LeaderboardId}
+	})
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// An index that should exist on a collection
+type indexDefinition struct {
+	keys   bson.D
+	unique bool
+}
+
+// The indexes kept on the collections of every track
+var (
+	scoreIndexes = []indexDefinition{
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "scoreId", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "playerId", Value: 1}, {Key: "leaderboardId", Value: 1}}},
+	}
+	standingIndexes = []indexDefinition{
+		// Finding the top scores of a leaderboard
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "leaderboardId", Value: 1}, {Key: "region", Value: 1}, {Key: "position", Value: 1}}},
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "leaderboardId", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}}, unique: true},
+		// Paging through a player's scores
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "leaderboardId", Value: 1}}},
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "scoreId", Value: 1}}},
+		// Finding every standing a player holds, such as when banning them
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "playerId", Value: 1}}},
+	}
+	playerIndexes = []indexDefinition{
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}}, unique: true},
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "playerId", Value: 1}}},
+		// Medal and first place leaderboards
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "medals", Value: -1}, {Key: "playerId", Value: 1}}},
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "positions.1", Value: -1}, {Key: "medals", Value: -1}}},
+		// Totalling clans and paging through their members
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "clan", Value: 1}, {Key: "medals", Value: -1}, {Key: "playerId", Value: 1}}},
+	}
+	changeIndexes = []indexDefinition{
+		{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "responsibleScoreId", Value: 1}}},
+		// Finding the oldest changes to roll up
+		{keys: bson.D{{Key: "timestamp", Value: 1}}},
+	}
+)
+
+// The indexes kept on the collections that aren't part of a track
+func collectionIndexes() map[*mongo.Collection][]indexDefinition {
+	return map[*mongo.Collection][]indexDefinition{
+		Collections.Bans: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "playerId", Value: 1}}, unique: true},
+		},
+		Collections.Leaderboards: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "leaderboardId", Value: 1}}, unique: true},
+		},
+		Collections.Seasons: {
+			{keys: bson.D{{Key: "seasonId", Value: 1}}, unique: true},
+		},
+		Collections.SeasonStandings: {
+			{keys: bson.D{{Key: "seasonId", Value: 1}, {Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "rank", Value: 1}, {Key: "playerId", Value: 1}}},
+		},
+		Collections.Snapshots: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "timestamp", Value: -1}}},
+		},
+		Collections.Achievements: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "playerId", Value: 1}, {Key: "achievementId", Value: 1}}, unique: true},
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "playerId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "achievementId", Value: 1}}},
+		},
+		Collections.Rivalries: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}, {Key: "sniperId", Value: 1}}, unique: true},
+			// Paging through the rivals in each direction
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}, {Key: "medalsLost", Value: -1}, {Key: "snipes", Value: -1}, {Key: "sniperId", Value: 1}}},
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "sniperId", Value: 1}, {Key: "medalsLost", Value: -1}, {Key: "snipes", Value: -1}, {Key: "playerId", Value: 1}}},
+		},
+		Collections.ScoreHistory: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}, {Key: "leaderboardId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "archivedAt", Value: 1}}},
+		},
+		Collections.RankChanges: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "region", Value: 1}, {Key: "playerId", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "responsibleLeaderboardId", Value: 1}}},
+		},
+		Collections.MapLeaders: {
+			{keys: bson.D{{Key: "platform", Value: 1}, {Key: "leaderboardId", Value: 1}, {Key: "region", Value: 1}}, unique: true},
+		},
+	}
+}
+
+// The indexes kept on the migrations collection, created before any migration is claimed
+var migrationIndexes = []indexDefinition{
+	{keys: bson.D{{Key: "version", Value: 1}}, unique: true},
+}
+
+// The tracks whose indexes have already been created by this process
+var indexedTracks sync.Map
+
+// Create every index that doesn't exist yet
+//
+// This is only called while starting up, where the engine can't run safely without its unique indexes, so
+// failing to create one is fatal
+func createIndexes(ctx context.Context) {
+	for collection, indexes := range collectionIndexes() {
+		if err := createCollectionIndexes(ctx, collection, indexes); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if err := createTrackIndexes(ctx, Lifetime); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// Create the indexes of a track's collections, once per process unless creating them fails
+func createTrackIndexes(ctx context.Context, track *Track) error {
+	if _, created := indexedTracks.LoadOrStore(track.Name, true); created {
+		return nil
+	}
+	for _, collection := range []struct {
+		collection *mongo.Collection
+		indexes    []indexDefinition
+	}{
+		{track.Scores, scoreIndexes},
+		{track.Standings, standingIndexes},
+		{track.Players, playerIndexes},
+		{track.Changes, changeIndexes},
+	} {
+		if err := createCollectionIndexes(ctx, collection.collection, collection.indexes); err != nil {
+			// Try again the next time the track is looked up
+			indexedTracks.Delete(track.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// Create the provided indexes on a collection, indexes that already exist are left alone
+//
+// Failures are logged rather than returned, as the data will still be correct, only slower to query. The
+// exception is unique indexes, which several processes rely on to avoid creating duplicates.
+func createCollectionIndexes(ctx context.Context, collection *mongo.Collection, indexes []indexDefinition) error {
+	var models, uniqueModels []mongo.IndexModel
+	for _, index := range indexes {
+		if index.unique {
+			uniqueModels = append(uniqueModels, mongo.IndexModel{Keys: index.keys, Options: options.Index().SetUnique(true)})
+			continue
+		}
+		models = append(models, mongo.IndexModel{Keys: index.keys})
+	}
+	// Index builds can take a while on large collections
+	ctx, cancel := context.WithTimeout(ctx, timeouts.migration)
+	defer cancel()
+	if len(uniqueModels) > 0 {
+		if _, err := collection.Indexes().CreateMany(ctx, uniqueModels); err != nil {
+			return fmt.Errorf("error when creating unique indexes on %s: %w", collection.Name(), err)
+		}
+	}
+	if len(models) > 0 {
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			log.Printf("error when creating indexes on %s: %s\n", collection.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,400 @@
+package database
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// A versioned change to the stored documents, applied once
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context) error
+}
+
+// Every migration, in the order they are applied
+//
+// Never change or remove a migration once released, add a new one instead
+var migrations = []migration{
+	{version: 1, name: "default position histograms", up: defaultPositionHistograms},
+	{version: 2, name: "default change reasons", up: defaultChangeReasons},
+	{version: 3, name: "remove duplicate players", up: removeDuplicatePlayers},
+	{version: 4, name: "standings from stored scores", up: standingsFromScores},
+}
+
+// How often to check whether a migration claimed by another process has been applied
+const migrationPollInterval = 5 * time.Second
+
+// Apply every migration that hasn't been applied yet, recording each in the migrations collection
+//
+// Each migration is claimed with an insert before it is applied, so when several processes start together
+// only one applies it while the others wait for it to finish. The engine can't run against a half migrated
+// database, so any failure is fatal.
+func runMigrations(ctx context.Context) {
+	// The claims rely on the unique index on the version, so it must exist before any is made
+	if err := createCollectionIndexes(ctx, Collections.Migrations, migrationIndexes); err != nil {
+		log.Fatalln(err)
+	}
+	for _, migration := range migrations {
+		claimed, err := InsertDocumentIfAbsent(ctx, Collections.Migrations, bson.M{"version": migration.version}, AppliedMigration{
+			Version: migration.version,
+			Name:    migration.name,
+		})
+		if err != nil {
+			log.Fatalf("error when claiming migration %d: %s\n", migration.version, err)
+		}
+		if !claimed {
+			if err = waitForMigration(ctx, migration); err != nil {
+				log.Fatalf("error when waiting for migration %d: %s\n", migration.version, err)
+			}
+			continue
+		}
+		log.Printf("applying migration %d (%s)", migration.version, migration.name)
+		if err = applyMigration(ctx, migration); err != nil {
+			// Release the claim, so the migration is tried again on the next start
+			if releaseErr := DeleteDocument(ctx, Collections.Migrations, bson.M{"version": migration.version}); releaseErr != nil {
+				log.Printf("error when releasing migration %d: %s\n", migration.version, releaseErr)
+			}
+			log.Fatalf("error when applying migration %d (%s): %s\n", migration.version, migration.name, err)
+		}
+		if err = UpdateDocument(ctx, Collections.Migrations, bson.M{"version": migration.version}, bson.M{
+			"$set": bson.M{"appliedAt": time.Now().UnixMilli()},
+		}); err != nil {
+			log.Fatalf("error when recording migration %d: %s\n", migration.version, err)
+		}
+	}
+}
+
+// Wait for a migration claimed by another process to be applied
+//
+// A claim left behind by a process that stopped while applying it is never completed, and must be
+// deleted from the migrations collection before the migration can be applied again
+func waitForMigration(ctx context.Context, migration migration) error {
+	for logged := false; ; logged = true {
+		var applied AppliedMigration
+		result, err := FetchDocument(ctx, Collections.Migrations, bson.M{"version": migration.version})
+		if err != nil {
+			return err
+		}
+		if err = result.Decode(&applied); err != nil {
+			return err
+		}
+		if applied.AppliedAt != 0 {
+			return nil
+		}
+		if !logged {
+			log.Printf("waiting for migration %d (%s) to be applied by another process", migration.version, migration.name)
+		}
+		select {
+		case <-time.After(migrationPollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Apply a single migration, giving it the migration timeout as a whole
+func applyMigration(ctx context.Context, migration migration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.migration)
+	defer cancel()
+	return migration.up(ctx)
+}
+
+// Return the collections of every track with the provided suffix, such as players
+func trackCollections(ctx context.Context, suffix string) ([]*mongo.Collection, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	names, err := Database.ListCollectionNames(ctx, bson.M{"name": bson.M{"$regex": "(^|_)" + suffix + "$"}})
+	if err != nil {
+		return nil, err
+	}
+	collections := make([]*mongo.Collection, 0, len(names))
+	for _, name := range names {
+		collections = append(collections, Database.Collection(name))
+	}
+	return collections, nil
+}
+
+// Players created before position histograms were kept have none at all
+func defaultPositionHistograms(ctx context.Context) error {
+	collections, err := trackCollections(ctx, "players")
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		if err = UpdateManyDocuments(ctx, collection, bson.M{"positions": nil}, bson.M{"$set": bson.M{"positions": bson.M{}}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Changes recorded before reasons were kept could only have been caused by scores
+func defaultChangeReasons(ctx context.Context) error {
+	collections, err := trackCollections(ctx, "changes")
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		if err = UpdateManyDocuments(ctx, collection, bson.M{"reason": nil}, bson.M{"$set": bson.M{"reason": "score"}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Concurrent scores could create the same player twice before players were uniquely indexed,
+// keep the document with the most medals
+func removeDuplicatePlayers(ctx context.Context) error {
+	collections, err := trackCollections(ctx, "players")
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		var duplicates []struct {
+			Ids []bson.ObjectID `bson:"ids"`
+		}
+		if err = AggregateDocuments(ctx, collection, bson.A{
+			bson.M{"$sort": bson.M{"medals": -1}},
+			bson.M{"$group": bson.M{
+				"_id":   bson.M{"platform": "$platform", "region": "$region", "playerId": "$playerId"},
+				"ids":   bson.M{"$push": "$_id"},
+				"count": bson.M{"$sum": 1},
+			}},
+			bson.M{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+		}, &duplicates); err != nil {
+			return err
+		}
+		for _, duplicate := range duplicates {
+			if err = DeleteManyDocuments(ctx, collection, bson.M{"_id": bson.M{"$in": duplicate.Ids[1:]}}); err != nil {
+				return err
+			}
+		}
+		if len(duplicates) > 0 {
+			log.Printf("removed duplicates of %d players from %s", len(duplicates), collection.Name())
+		}
+	}
+	return nil
+}
+
+// Scores were stored without a region before standings were kept, rebuild the standings of every
+// leaderboard from them, using the current country of each player
+//
+// The scores are streamed a leaderboard at a time, best first, keeping the tracked positions of each
+// region. The medals and positions of every player are then recomputed from the rebuilt standings.
+func standingsFromScores(ctx context.Context) error {
+	collections, err := trackCollections(ctx, "scores")
+	if err != nil {
+		return err
+	}
+	for _, collection := range collections {
+		prefix := strings.TrimSuffix(collection.Name(), "scores")
+		players := Database.Collection(prefix + "players")
+		countries, err := playerCountries(ctx, players)
+		if err != nil {
+			return err
+		}
+		standings := Database.Collection(prefix + "standings")
+		if err = DeleteManyDocuments(ctx, standings, bson.M{}); err != nil {
+			return err
+		}
+		rebuild := &standingsRebuild{
+			collection: standings,
+			tracked:    TrackedPositions(),
+			regions:    make(map[string][]Standing),
+			medals:     make(map[playerRegion]*playerMedals),
+		}
+		if err = eachDocument(ctx, collection, bson.A{bson.M{"$sort": bson.D{
+			{Key: "platform", Value: 1},
+			{Key: "leaderboardId", Value: 1},
+			{Key: "score", Value: -1},
+			{Key: "timestamp", Value: 1},
+		}}}, func(score Score) error {
+			regions := []string{GlobalRegion}
+			if country, ok := countries[playerKey(score.Platform, score.PlayerId)]; ok {
+				regions = append(regions, country)
+			}
+			return rebuild.add(ctx, score, regions)
+		}); err != nil {
+			return err
+		}
+		if err = rebuild.finishLeaderboard(ctx, true); err != nil {
+			return err
+		}
+		if err = rebuild.updatePlayers(ctx, players); err != nil {
+			return err
+		}
+		log.Printf("rebuilt %d standings and the medals of %d players from %s", rebuild.inserted, len(rebuild.medals), collection.Name())
+	}
+	return nil
+}
+
+// A player in a platform and region
+type playerRegion struct {
+	platform int
+	region   string
+	playerId string
+}
+
+// The medals and position histogram a player holds in a region
+type playerMedals struct {
+	medals    int
+	positions map[string]int
+}
+
+// The standings being rebuilt from a track's scores, one leaderboard at a time
+type standingsRebuild struct {
+	collection *mongo.Collection
+	tracked    int
+	// The leaderboard whose scores are being placed, and its standings in each region
+	platform      int
+	leaderboardId string
+	regions       map[string][]Standing
+	// The standings of finished leaderboards waiting to be inserted
+	pending  []any
+	inserted int
+	medals   map[playerRegion]*playerMedals
+}
+
+// Place a score in each of the regions, the scores of each leaderboard must be added best first
+func (rebuild *standingsRebuild) add(ctx context.Context, score Score, regions []string) error {
+	if score.Platform != rebuild.platform || score.LeaderboardId != rebuild.leaderboardId {
+		if err := rebuild.finishLeaderboard(ctx, false); err != nil {
+			return err
+		}
+		rebuild.platform = score.Platform
+		rebuild.leaderboardId = score.LeaderboardId
+	}
+	for _, region := range regions {
+		standings := rebuild.regions[region]
+		// Each player's first score in a region is their best
+		if len(standings) >= rebuild.tracked || slices.ContainsFunc(standings, func(standing Standing) bool {
+			return standing.PlayerId == score.PlayerId
+		}) {
+			continue
+		}
+		rebuild.regions[region] = append(standings, Standing{
+			Platform:      score.Platform,
+			LeaderboardId: score.LeaderboardId,
+			Region:        region,
+			Position:      len(standings) + 1,
+			ScoreId:       score.ScoreId,
+			PlayerId:      score.PlayerId,
+			Score:         score.Score,
+			Timestamp:     score.Timestamp,
+		})
+	}
+	return nil
+}
+
+// Credit the medals of the current leaderboard's standings and queue them for inserting, inserting a batch
+// once enough are queued, or everything queued when flushing
+func (rebuild *standingsRebuild) finishLeaderboard(ctx context.Context, flush bool) error {
+	for region, standings := range rebuild.regions {
+		for _, standing := range standings {
+			key := playerRegion{standing.Platform, region, standing.PlayerId}
+			held, ok := rebuild.medals[key]
+			if !ok {
+				held = &playerMedals{positions: make(map[string]int)}
+				rebuild.medals[key] = held
+			}
+			held.medals += MedalValues[standing.Position-1]
+			if standing.Position <= MedalPositions {
+				held.positions[strconv.Itoa(standing.Position)]++
+			}
+			rebuild.pending = append(rebuild.pending, standing)
+		}
+		delete(rebuild.regions, region)
+	}
+	if len(rebuild.pending) < transferBatchSize && !(flush && len(rebuild.pending) > 0) {
+		return nil
+	}
+	if err := InsertManyDocuments(ctx, rebuild.collection, rebuild.pending); err != nil {
+		return err
+	}
+	rebuild.inserted += len(rebuild.pending)
+	rebuild.pending = rebuild.pending[:0]
+	return nil
+}
+
+// Replace the medals and positions of every player with those of the rebuilt standings
+//
+// Players without any standings are left with none, and players missing from a region they stand in are
+// created, their profile is filled in from the next score they set
+func (rebuild *standingsRebuild) updatePlayers(ctx context.Context, collection *mongo.Collection) error {
+	if err := UpdateManyDocuments(ctx, collection, bson.M{}, bson.M{"$set": bson.M{"medals": 0, "positions": bson.M{}}}); err != nil {
+		return err
+	}
+	models := make([]mongo.WriteModel, 0, transferBatchSize)
+	for key, held := range rebuild.medals {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"playerId": key.playerId, "platform": key.platform, "region": key.region}).
+			SetUpdate(bson.M{"$set": bson.M{"medals": held.medals, "positions": held.positions}, "$setOnInsert": bson.M{"username": ""}}).
+			SetUpsert(true))
+		if len(models) < transferBatchSize {
+			continue
+		}
+		if err := BulkWriteDocuments(ctx, collection, models); err != nil {
+			return err
+		}
+		models = models[:0]
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	return BulkWriteDocuments(ctx, collection, models)
+}
+
+// Return the country of each player, keyed by platform and player id
+//
+// The country of the player's profile is used, as their scores count there from now on. Players whose
+// profile hasn't been refreshed yet have no country, so the country they hold medals in is used when
+// there is only one. Players holding medals in several countries without a profile are left out, so
+// their scores only stand globally until they next score.
+func playerCountries(ctx context.Context, collection *mongo.Collection) (map[string]string, error) {
+	var players []Player
+	if err := FetchDocuments(ctx, collection, bson.M{}, &players); err != nil {
+		return nil, err
+	}
+	countries := make(map[string]string, len(players))
+	held := make(map[string]map[string]bool)
+	for _, player := range players {
+		key := playerKey(player.Platform, player.PlayerId)
+		if player.Country != "" {
+			countries[key] = player.Country
+		} else if player.Region != GlobalRegion {
+			if held[key] == nil {
+				held[key] = make(map[string]bool)
+			}
+			held[key][player.Region] = true
+		}
+	}
+	ambiguous := 0
+	for key, regions := range held {
+		if _, ok := countries[key]; ok {
+			continue
+		}
+		if len(regions) > 1 {
+			ambiguous++
+			continue
+		}
+		for region := range regions {
+			countries[key] = region
+		}
+	}
+	if ambiguous > 0 {
+		log.Printf("%d players hold medals in several countries without a profile country, their scores only stand globally", ambiguous)
+	}
+	return countries, nil
+}
+
+func playerKey(platform int, playerId string) string {
+	return strconv.Itoa(platform) + "/" + playerId
+}
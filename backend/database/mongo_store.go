@@ -0,0 +1,918 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// The store keeping each track's standings in its own MongoDB collections
+type mongoStore struct{}
+
+// Fetch a score from the database
+func (mongoStore) GetScore(ctx context.Context, track *Track, platform int, scoreId string) (Score, error) {
+	document, err := FetchDocument(ctx, track.Scores, bson.M{
+		"platform": platform,
+		"scoreId":  scoreId,
+	})
+	if err != nil {
+		return Score{}, err
+	}
+	var score Score
+	err = document.Decode(&score)
+	if err != nil {
+		return Score{}, err
+	}
+	return score, nil
+}
+
+// Fetch a page of a player's scores from the database, newest first
+func (mongoStore) GetPlayerScores(ctx context.Context, track *Track, player *Player, request PageRequest, before int64, after int64) (Page[Score], error) {
+	cursor, err := decodeCursor(request.Cursor, playerScoreSort)
+	if err != nil {
+		return Page[Score]{}, err
+	}
+	// Build the mongo filter
+	filter := bson.M{
+		"platform": player.Platform,
+		"playerId": player.PlayerId,
+		"region":   player.Region,
+	}
+	// Add the before and after filters
+	if before != 0 || after != 0 {
+		timestamp := bson.M{}
+		if before != 0 {
+			timestamp["$lte"] = before
+		}
+		if after != 0 {
+			timestamp["$gte"] = after
+		}
+		filter["timestamp"] = timestamp
+	}
+	total, err := countTotal(ctx, track.Standings, filter, request)
+	if err != nil {
+		return Page[Score]{}, err
+	}
+	addKeysetFilter(filter, playerScoreSort, cursor)
+	// Fetch the player's standings in the region, then the scores holding them
+	var standings []Standing
+	if err := FetchDocuments(ctx, track.Standings, filter, &standings, options.Find().SetSort(sortFor(playerScoreSort, cursor)).SetLimit(int64(request.limit()+1))); err != nil {
+		return Page[Score]{}, err
+	}
+	standingPage := buildPage(standings, request, cursor, func(standing Standing) []any {
+		return []any{standing.Timestamp, standing.LeaderboardId}
+	})
+	scoreIds := make([]string, 0, len(standingPage.Items))
+	for _, standing := range standingPage.Items {
+		scoreIds = append(scoreIds, standing.ScoreId)
+	}
+	var scores []Score
+	if err := FetchDocuments(ctx, track.Scores, bson.M{
+		"platform": player.Platform,
+		"scoreId":  bson.M{"$in": scoreIds},
+	}, &scores); err != nil {
+		return Page[Score]{}, err
+	}
+	// Return the scores in the same order as their standings
+	scoresById := make(map[string]Score, len(scores))
+	for _, score := range scores {
+		scoresById[score.ScoreId] = score
+	}
+	page := Page[Score]{Items: make([]Score, 0, len(scores)), Next: standingPage.Next, Prev: standingPage.Prev, Total: total}
+	for _, standing := range standingPage.Items {
+		if score, ok := scoresById[standing.ScoreId]; ok {
+			page.Items = append(page.Items, score)
+		}
+	}
+	return page, nil
+}
+
+// Fetch a page of a player's changes from the database, in the order they were recorded
+func (mongoStore) GetChanges(ctx context.Context, track *Track, platform int, region string, playerId string, request PageRequest, before int64, after int64) (Page[Change], error) {
+	cursor, err := decodeCursor(request.Cursor, changeSort)
+	if err != nil {
+		return Page[Change]{}, err
+	}
+	// Build the mongo filter
+	filter := bson.M{
+		"platform": platform,
+		"playerId": playerId,
+		"region":   region,
+	}
+	// Add the before and after filters
+	if before != 0 || after != 0 {
+		timestamp := bson.M{}
+		if before != 0 {
+			timestamp["$lte"] = before
+		}
+		if after != 0 {
+			timestamp["$gte"] = after
+		}
+		filter["timestamp"] = timestamp
+	}
+	total, err := countTotal(ctx, track.Changes, filter, request)
+	if err != nil {
+		return Page[Change]{}, err
+	}
+	addKeysetFilter(filter, changeSort, cursor)
+	// Fetch the changes from the database
+	var changes []Change
+	if err := FetchDocuments(ctx, track.Changes, filter, &changes, options.Find().SetSort(sortFor(changeSort, cursor)).SetLimit(int64(request.limit()+1))); err != nil {
+		return Page[Change]{}, err
+	}
+	page := buildPage(changes, request, cursor, func(change Change) []any {
+		return []any{change.Timestamp, change.ResponsibleScoreId}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Return whether the provided score is within the top scores tracked for that leaderboard
+func (mongoStore) IsWithinTopTen(ctx context.Context, track *Track, platform int, leaderboardId string, region string, score int, depth int) (bool, error) {
+	var standings []Standing
+	if err := FetchDocuments(ctx, track.Standings, bson.M{
+		"platform":      platform,
+		"leaderboardId": leaderboardId,
+		"region":        region,
+	}, &standings, options.Find().SetSort(bson.D{{Key: "position", Value: 1}}).SetSkip(int64(depth-1)).SetLimit(1)); err != nil {
+		return false, err
+	}
+	// Check if we actually got any results
+	if len(standings) == 0 {
+		// The leaderboard isn't full, so any score is within it
+		return true, nil
+	}
+	return score > standings[0].Score, nil
+}
+
+// Get the standings of a leaderboard in a region, best first, up to the provided limit
+func (mongoStore) GetStandings(ctx context.Context, track *Track, platform int, region string, leaderboardId string, limit int64) ([]Standing, error) {
+	filter := bson.M{
+		"platform":      platform,
+		"region":        region,
+		"leaderboardId": leaderboardId,
+	}
+	var standings []Standing
+	if err := FetchDocuments(ctx, track.Standings, filter, &standings, options.Find().SetSort(bson.D{{Key: "position", Value: 1}}).SetLimit(limit)); err != nil {
+		return []Standing{}, err
+	}
+	return standings, nil
+}
+
+// Fetch every standing a player holds on the platform, in any region, including reserve positions
+func (mongoStore) GetPlayerStandings(ctx context.Context, track *Track, platform int, playerId string) ([]Standing, error) {
+	var standings []Standing
+	if err := FetchDocuments(ctx, track.Standings, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	}, &standings, options.Find().SetSort(bson.D{{Key: "leaderboardId", Value: 1}, {Key: "region", Value: 1}})); err != nil {
+		return []Standing{}, err
+	}
+	return standings, nil
+}
+
+// Replace the standings of a leaderboard in a region
+func (mongoStore) SetStandings(ctx context.Context, track *Track, platform int, leaderboardId string, region string, standings []Standing) error {
+	if err := DeleteManyDocuments(ctx, track.Standings, bson.M{
+		"platform":      platform,
+		"leaderboardId": leaderboardId,
+		"region":        region,
+	}); err != nil {
+		return err
+	}
+	if len(standings) == 0 {
+		return nil
+	}
+	documents := make([]any, 0, len(standings))
+	for _, standing := range standings {
+		documents = append(documents, standing)
+	}
+	return InsertManyDocuments(ctx, track.Standings, documents)
+}
+
+// Get every standing of the most recently scored leaderboard regions, up to the provided number of regions
+//
+// The standings are grouped by leaderboard region, best first within each
+func (mongoStore) GetRecentStandings(ctx context.Context, track *Track, limit int) ([]Standing, error) {
+	var regions []struct {
+		Standings []Standing `bson:"standings"`
+	}
+	if err := AggregateDocuments(ctx, track.Standings, bson.A{
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"platform":      "$platform",
+				"leaderboardId": "$leaderboardId",
+				"region":        "$region",
+			},
+			"latest": bson.M{"$max": "$timestamp"},
+		}},
+		bson.M{"$sort": bson.D{{Key: "latest", Value: -1}}},
+		bson.M{"$limit": limit},
+		// Fetch each region's standings in order
+		bson.M{"$lookup": bson.M{
+			"from": track.Standings.Name(),
+			"let":  bson.M{"platform": "$_id.platform", "leaderboardId": "$_id.leaderboardId", "region": "$_id.region"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$platform", "$$platform"}},
+					bson.M{"$eq": bson.A{"$leaderboardId", "$$leaderboardId"}},
+					bson.M{"$eq": bson.A{"$region", "$$region"}},
+				}}}},
+				bson.M{"$sort": bson.D{{Key: "position", Value: 1}}},
+			},
+			"as": "standings",
+		}},
+	}, &regions); err != nil {
+		return nil, err
+	}
+	var standings []Standing
+	for _, region := range regions {
+		standings = append(standings, region.Standings...)
+	}
+	return standings, nil
+}
+
+// Get a page of the medal holders for a region
+func (mongoStore) GetTopTenMedalHolders(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[Player], error) {
+	sort := medalHolderSort
+	if sortBy == SortByFirsts {
+		sort = firstsHolderSort
+	}
+	cursor, err := decodeCursor(request.Cursor, sort)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	filter := bson.M{
+		"platform": platform,
+		"region":   region,
+	}
+	total, err := countTotal(ctx, track.Players, filter, request)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	pageFilter := bson.M{}
+	addKeysetFilter(pageFilter, sort, cursor)
+	// Players without any first places have no count for them, so count those as 0 to sort and page by
+	var players []Player
+	if err := AggregateDocuments(ctx, track.Players, bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$addFields": bson.M{"firsts": bson.M{"$ifNull": bson.A{"$positions.1", 0}}}},
+		bson.M{"$match": pageFilter},
+		bson.M{"$sort": sortFor(sort, cursor)},
+		bson.M{"$limit": request.limit() + 1},
+	}, &players); err != nil {
+		return Page[Player]{}, err
+	}
+	page := buildPage(players, request, cursor, func(player Player) []any {
+		if sortBy == SortByFirsts {
+			return []any{int64(player.Positions["1"]), int64(player.Medals), player.PlayerId}
+		}
+		return []any{int64(player.Medals), player.PlayerId}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Fetch a player from the database, optionally creating one if they don't exist
+func (mongoStore) GetPlayer(ctx context.Context, track *Track, platform int, region string, playerId string, username string, createIfAbsent bool) (*Player, error) {
+	filter := bson.M{
+		"platform": platform,
+		"playerId": playerId,
+		"region":   region,
+	}
+	document, err := FetchDocument(ctx, track.Players, filter)
+	// Create the player document if they don't exist already
+	if err == mongo.ErrNoDocuments && createIfAbsent {
+		// Players are unique by platform, region and id, so when several processes create the same
+		// player at once only one insert takes effect and the rest leave it untouched
+		if _, err = InsertDocumentIfAbsent(ctx, track.Players, filter, Player{
+			PlayerId:  playerId,
+			Platform:  platform,
+			Region:    region,
+			Medals:    0,
+			Username:  username,
+			Positions: map[string]int{},
+		}); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+		document, err = FetchDocument(ctx, track.Players, filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var player Player
+	if err = document.Decode(&player); err != nil {
+		return nil, err
+	}
+	return &player, nil
+}
+
+// Fetch every score a player has stored on the platform, regardless of region
+func (mongoStore) GetAllPlayerScores(ctx context.Context, track *Track, platform int, playerId string) ([]Score, error) {
+	var scores []Score
+	if err := FetchDocuments(ctx, track.Scores, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	}, &scores); err != nil {
+		return []Score{}, err
+	}
+	return scores, nil
+}
+
+// Fetch every region document held by a player on the platform
+func (mongoStore) GetPlayerRegions(ctx context.Context, track *Track, platform int, playerId string) ([]Player, error) {
+	var players []Player
+	if err := FetchDocuments(ctx, track.Players, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	}, &players); err != nil {
+		return []Player{}, err
+	}
+	return players, nil
+}
+
+// Fetch every player in a track, grouped by platform and region and ordered by medals
+func (mongoStore) GetTrackStandings(ctx context.Context, track *Track) ([]Player, error) {
+	var players []Player
+	if err := FetchDocuments(ctx, track.Players, bson.M{}, &players, options.Find().SetSort(bson.D{
+		{Key: "platform", Value: 1},
+		{Key: "region", Value: 1},
+		{Key: "medals", Value: -1},
+	})); err != nil {
+		return []Player{}, err
+	}
+	return players, nil
+}
+
+// Return the rank a player would hold with the provided medals, among the other players in their platform and region
+//
+// Ranks are competition ranks, so players with equal medals share a rank and the next rank is skipped
+func (mongoStore) GetMedalRank(ctx context.Context, track *Track, platform int, region string, playerId string, medals int) (int, error) {
+	ahead, err := CountDocuments(ctx, track.Players, bson.M{
+		"platform": platform,
+		"region":   region,
+		"playerId": bson.M{"$ne": playerId},
+		"medals":   bson.M{"$gt": medals},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(ahead) + 1, nil
+}
+
+// Fetch the players in a platform and region holding between the lower and upper medals inclusive, most medals first
+func (mongoStore) GetPlayersWithinMedals(ctx context.Context, track *Track, platform int, region string, lower int, upper int) ([]Player, error) {
+	var players []Player
+	if err := FetchDocuments(ctx, track.Players, bson.M{
+		"platform": platform,
+		"region":   region,
+		"medals":   bson.M{"$gte": lower, "$lte": upper},
+	}, &players, options.Find().SetSort(bson.D{
+		{Key: "medals", Value: -1},
+		{Key: "playerId", Value: 1},
+	})); err != nil {
+		return []Player{}, err
+	}
+	return players, nil
+}
+
+// Fetch the scores a player has stored on a leaderboard
+func (mongoStore) GetLeaderboardScores(ctx context.Context, track *Track, platform int, leaderboardId string, playerId string) ([]Score, error) {
+	var scores []Score
+	if err := FetchDocuments(ctx, track.Scores, bson.M{
+		"platform":      platform,
+		"leaderboardId": leaderboardId,
+		"playerId":      playerId,
+	}, &scores); err != nil {
+		return []Score{}, err
+	}
+	return scores, nil
+}
+
+// Insert a newly tracked score
+func (mongoStore) InsertScore(ctx context.Context, track *Track, score Score) error {
+	return InsertDocument(ctx, track.Scores, score)
+}
+
+// Delete a score that is no longer tracked
+func (mongoStore) DeleteScore(ctx context.Context, track *Track, platform int, scoreId string) error {
+	return DeleteDocument(ctx, track.Scores, bson.M{
+		"platform": platform,
+		"scoreId":  scoreId,
+	})
+}
+
+// Delete a score once no region's standings refer to it
+func (mongoStore) DeleteUntrackedScore(ctx context.Context, track *Track, platform int, scoreId string) error {
+	standings, err := CountDocuments(ctx, track.Standings, bson.M{
+		"platform": platform,
+		"scoreId":  scoreId,
+	})
+	if err != nil || standings > 0 {
+		return err
+	}
+	return DeleteDocument(ctx, track.Scores, bson.M{
+		"platform": platform,
+		"scoreId":  scoreId,
+	})
+}
+
+// Delete every score a player has stored on the platform
+func (mongoStore) DeletePlayerScores(ctx context.Context, track *Track, platform int, playerId string) error {
+	return DeleteManyDocuments(ctx, track.Scores, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	})
+}
+
+// Add to the medals and position histograms of players in a region, creating any player who doesn't exist
+//
+// The deltas are applied with a single bulk write of atomic increments, then the updated players are read
+// back together. Players are unique by platform, region and id, so when several processes create the same
+// player at once the server retries the upserts that lose the race as plain increments.
+func (mongoStore) ApplyMedalDeltas(ctx context.Context, track *Track, platform int, region string, deltas []MedalDelta) ([]Player, error) {
+	if len(deltas) == 0 {
+		return []Player{}, nil
+	}
+	models := make([]mongo.WriteModel, 0, len(deltas))
+	playerIds := make(bson.A, 0, len(deltas))
+	for _, delta := range deltas {
+		increments := bson.M{"medals": delta.Medals}
+		for position, count := range delta.Positions {
+			increments["positions."+position] = count
+		}
+		// New players start with no profile, which is filled in from the next score they set
+		created := bson.M{"username": ""}
+		if len(delta.Positions) == 0 {
+			created["positions"] = bson.M{}
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"playerId": delta.PlayerId, "platform": platform, "region": region}).
+			SetUpdate(bson.M{"$inc": increments, "$setOnInsert": created}).
+			SetUpsert(true))
+		playerIds = append(playerIds, delta.PlayerId)
+	}
+	if err := BulkWriteDocuments(ctx, track.Players, models); err != nil {
+		return appliedPlayers(platform, region, deltas, err), err
+	}
+	// Every delta has been applied, so failing to read the players back still returns who they were
+	var updated []Player
+	if err := FetchDocuments(ctx, track.Players, bson.M{
+		"playerId": bson.M{"$in": playerIds},
+		"platform": platform,
+		"region":   region,
+	}, &updated); err != nil {
+		return playerIdentities(platform, region, deltas), err
+	}
+	// Return the players in the order of their deltas
+	byId := make(map[string]Player, len(updated))
+	for _, player := range updated {
+		byId[player.PlayerId] = player
+	}
+	players := make([]Player, 0, len(deltas))
+	for _, delta := range deltas {
+		player, ok := byId[delta.PlayerId]
+		if !ok {
+			return playerIdentities(platform, region, deltas), ErrNotFound
+		}
+		players = append(players, player)
+	}
+	return players, nil
+}
+
+// Return the players a failed bulk write of deltas was still applied to, holding only their ids
+//
+// The writes are ordered, so every delta before the first write error was applied. A write concern
+// error alone means every delta was applied but may not have been replicated yet.
+func appliedPlayers(platform int, region string, deltas []MedalDelta, err error) []Player {
+	var exception mongo.BulkWriteException
+	if !errors.As(err, &exception) {
+		return nil
+	}
+	applied := len(deltas)
+	if len(exception.WriteErrors) > 0 {
+		applied = exception.WriteErrors[0].Index
+	}
+	return playerIdentities(platform, region, deltas[:applied])
+}
+
+// Return the players the deltas are for, holding only their ids
+func playerIdentities(platform int, region string, deltas []MedalDelta) []Player {
+	players := make([]Player, 0, len(deltas))
+	for _, delta := range deltas {
+		players = append(players, Player{PlayerId: delta.PlayerId, Platform: platform, Region: region})
+	}
+	return players
+}
+
+// Record changes in players' medals
+func (mongoStore) InsertChanges(ctx context.Context, track *Track, changes []Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	documents := make([]any, 0, len(changes))
+	for _, change := range changes {
+		documents = append(documents, change)
+	}
+	return InsertManyDocuments(ctx, track.Changes, documents)
+}
+
+// Call fn with each player matching the filter, stopping at the first error
+func (mongoStore) EachPlayer(ctx context.Context, track *Track, filter ExportFilter, fn func(Player) error) error {
+	return eachDocument(ctx, track.Players, bson.A{bson.M{"$match": filter.match(true, false)}}, fn)
+}
+
+// Call fn with each score matching the filter, stopping at the first error
+func (mongoStore) EachScore(ctx context.Context, track *Track, filter ExportFilter, fn func(Score) error) error {
+	if filter.Region == "" {
+		return eachDocument(ctx, track.Scores, bson.A{bson.M{"$match": filter.match(false, true)}}, fn)
+	}
+	// Scores have no region of their own, so find them through the standings of the region
+	return eachDocument(ctx, track.Standings, bson.A{
+		bson.M{"$match": filter.match(true, false)},
+		bson.M{"$lookup": bson.M{
+			"from": track.Scores.Name(),
+			"let":  bson.M{"platform": "$platform", "scoreId": "$scoreId"},
+			"pipeline": bson.A{
+				bson.M{"$match": bson.M{"$expr": bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{"$platform", "$$platform"}},
+					bson.M{"$eq": bson.A{"$scoreId", "$$scoreId"}},
+				}}}},
+			},
+			"as": "score",
+		}},
+		bson.M{"$unwind": "$score"},
+		bson.M{"$replaceRoot": bson.M{"newRoot": "$score"}},
+		bson.M{"$match": filter.match(false, true)},
+	}, fn)
+}
+
+// Call fn with each change matching the filter, stopping at the first error
+func (mongoStore) EachChange(ctx context.Context, track *Track, filter ExportFilter, fn func(Change) error) error {
+	return eachDocument(ctx, track.Changes, bson.A{bson.M{"$match": filter.match(true, true)}}, fn)
+}
+
+// Call fn with each standing matching the filter, stopping at the first error
+func (mongoStore) EachStanding(ctx context.Context, track *Track, filter ExportFilter, fn func(Standing) error) error {
+	return eachDocument(ctx, track.Standings, bson.A{bson.M{"$match": filter.match(true, true)}}, fn)
+}
+
+// Store players, replacing any already stored in the same platform and region
+func (mongoStore) UpsertPlayers(ctx context.Context, track *Track, players []Player) error {
+	return replaceDocuments(ctx, track.Players, players, func(player Player) bson.M {
+		return bson.M{"platform": player.Platform, "region": player.Region, "playerId": player.PlayerId}
+	})
+}
+
+// Store scores, replacing any already stored with the same id
+func (mongoStore) UpsertScores(ctx context.Context, track *Track, scores []Score) error {
+	return replaceDocuments(ctx, track.Scores, scores, func(score Score) bson.M {
+		return bson.M{"platform": score.Platform, "scoreId": score.ScoreId}
+	})
+}
+
+// Store changes, replacing any already recorded for the same player, cause and time
+func (mongoStore) UpsertChanges(ctx context.Context, track *Track, changes []Change) error {
+	return replaceDocuments(ctx, track.Changes, changes, func(change Change) bson.M {
+		return bson.M{
+			"platform":           change.Platform,
+			"region":             change.Region,
+			"playerId":           change.PlayerId,
+			"timestamp":          change.Timestamp,
+			"responsibleScoreId": change.ResponsibleScoreId,
+			"reason":             change.Reason,
+		}
+	})
+}
+
+// Store standings, replacing any already stored for the same player on the leaderboard and region
+func (mongoStore) UpsertStandings(ctx context.Context, track *Track, standings []Standing) error {
+	return replaceDocuments(ctx, track.Standings, standings, func(standing Standing) bson.M {
+		return bson.M{"platform": standing.Platform, "leaderboardId": standing.LeaderboardId, "region": standing.Region, "playerId": standing.PlayerId}
+	})
+}
+
+// Return whether any changes have been rolled up
+func (mongoStore) HasRollups(ctx context.Context, track *Track) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	count, err := track.Changes.CountDocuments(ctx, bson.M{"reason": ChangeReasonRollup}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// Return the timestamp of the oldest raw change recorded from after up to (not including) before, or false if there are none
+func (mongoStore) GetOldestChangeTimestamp(ctx context.Context, track *Track, after int64, before int64) (int64, bool, error) {
+	document, err := FetchDocument(ctx, track.Changes, bson.M{
+		"timestamp": bson.M{"$gte": after, "$lt": before},
+		"reason":    bson.M{"$ne": ChangeReasonRollup},
+	}, options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: 1}}).SetProjection(bson.M{"timestamp": 1}))
+	if err == mongo.ErrNoDocuments {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	var change Change
+	if err = document.Decode(&change); err != nil {
+		return 0, false, err
+	}
+	return change.Timestamp, true, nil
+}
+
+// A change along with the id of its document
+type identifiedChange struct {
+	Id     bson.ObjectID `bson:"_id"`
+	Change `bson:",inline"`
+}
+
+// Call fn with each change recorded from from up to (not including) to, along with the id it is stored under
+func (mongoStore) EachChangeWithId(ctx context.Context, track *Track, from int64, to int64, fn func(string, Change) error) error {
+	return eachDocument(ctx, track.Changes, bson.A{bson.M{"$match": bson.M{"timestamp": bson.M{"$gte": from, "$lt": to}}}}, func(change identifiedChange) error {
+		return fn(change.Id.Hex(), change.Change)
+	})
+}
+
+// Replace the rollups of the days from from up to (not including) to, and delete the raw changes folded into them
+//
+// Each rollup records the ids of the raw changes it holds until they are deleted, so if deleting them fails
+// rolling up the day again won't fold them in twice. Only the changes that were read are deleted, any
+// recorded since are left for the next roll up.
+func (mongoStore) CompactChanges(ctx context.Context, track *Track, from int64, to int64, rollups []Change, folded []string) error {
+	models := make([]mongo.WriteModel, 0, len(rollups))
+	for _, rollup := range rollups {
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(bson.M{
+			"platform":  rollup.Platform,
+			"region":    rollup.Region,
+			"playerId":  rollup.PlayerId,
+			"timestamp": rollup.Timestamp,
+			"reason":    ChangeReasonRollup,
+		}).SetReplacement(rollup).SetUpsert(true))
+	}
+	if err := BulkWriteDocuments(ctx, track.Changes, models); err != nil {
+		return err
+	}
+	for start := 0; start < len(folded); start += transferBatchSize {
+		ids := make(bson.A, 0, transferBatchSize)
+		for _, hex := range folded[start:min(start+transferBatchSize, len(folded))] {
+			id, err := bson.ObjectIDFromHex(hex)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := DeleteManyDocuments(ctx, track.Changes, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return err
+		}
+	}
+	// The folded changes are gone, so the rollups no longer need to remember them
+	return UpdateManyDocuments(ctx, track.Changes, bson.M{
+		"timestamp":     bson.M{"$gte": from, "$lt": to},
+		"reason":        ChangeReasonRollup,
+		"rollup.folded": bson.M{"$exists": true},
+	}, bson.M{"$unset": bson.M{"rollup.folded": ""}})
+}
+
+// Refresh a player's profile in every region of the track, recording any new username or country
+//
+// The history is decided against the stored player as it is updated, so several processes handling the
+// player's scores record each new username or country once
+func (mongoStore) UpdatePlayerProfile(ctx context.Context, track *Track, platform int, playerId string, profile PlayerProfile) error {
+	set := bson.M{"username": bson.M{"$literal": profile.Username}}
+	// Not every platform sends every field, so only overwrite what we were sent
+	if profile.Avatar != "" {
+		set["avatar"] = bson.M{"$literal": profile.Avatar}
+	}
+	if profile.Country != "" {
+		set["country"] = bson.M{"$literal": profile.Country}
+	}
+	if profile.PP > 0 {
+		set["pp"] = profile.PP
+	}
+	if profile.Rank > 0 {
+		set["rank"] = profile.Rank
+	}
+	if profile.Role != "" {
+		set["role"] = bson.M{"$literal": profile.Role}
+	}
+	if profile.Clan != nil {
+		set["clan"] = bson.M{"$literal": *profile.Clan}
+	}
+	// Record the username if it has changed, or if we've never seen one
+	history := bson.M{"usernameHistory": appendIfChanged("usernameHistory", "username", profile.Username, UsernameRecord{
+		Username:  profile.Username,
+		Timestamp: profile.Timestamp,
+	})}
+	// Likewise for the country
+	if profile.Country != "" {
+		history["countryHistory"] = appendIfChanged("countryHistory", "country", profile.Country, CountryRecord{
+			Country:   profile.Country,
+			Timestamp: profile.Timestamp,
+		})
+	}
+	// The history is worked out from the stored profile, so it must be updated before the profile itself
+	return UpdateManyDocuments(ctx, track.Players, bson.M{"playerId": playerId, "platform": platform}, bson.A{bson.M{"$set": history}, bson.M{"$set": set}})
+}
+
+// Build an update expression appending the record to a history array when the stored field differs from
+// the value, or when the history is empty
+func appendIfChanged(historyField string, field string, value string, record any) bson.M {
+	history := bson.M{"$ifNull": bson.A{"$" + historyField, bson.A{}}}
+	return bson.M{"$cond": bson.A{
+		bson.M{"$or": bson.A{
+			bson.M{"$ne": bson.A{"$" + field, bson.M{"$literal": value}}},
+			bson.M{"$eq": bson.A{bson.M{"$size": history}, 0}},
+		}},
+		bson.M{"$concatArrays": bson.A{history, bson.A{bson.M{"$literal": record}}}},
+		"$" + historyField,
+	}}
+}
+
+// Total the snipes between every pair of players from the changes ledger
+//
+// A snipe is a score taking medals from another player
+func (mongoStore) GetSnipeTotals(ctx context.Context, track *Track) ([]Rivalry, error) {
+	// Aggregating the whole ledger can take a while, so this is given as long as a migration
+	ctx, cancel := context.WithTimeout(ctx, timeouts.migration)
+	defer cancel()
+	cursor, err := track.Changes.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{
+			"reason":      bson.M{"$in": bson.A{"score", nil}},
+			"medalChange": bson.M{"$lt": 0},
+			"$expr":       bson.M{"$ne": bson.A{"$playerId", "$responsiblePlayerId"}},
+		}},
+		bson.M{"$group": bson.M{
+			"_id": bson.M{
+				"platform": "$platform",
+				"region":   "$region",
+				"playerId": "$playerId",
+				"sniperId": "$responsiblePlayerId",
+			},
+			"snipes":     bson.M{"$sum": 1},
+			"medalsLost": bson.M{"$sum": bson.M{"$multiply": bson.A{"$medalChange", -1}}},
+		}},
+		bson.M{"$project": bson.M{
+			"_id":        0,
+			"platform":   "$_id.platform",
+			"region":     "$_id.region",
+			"playerId":   "$_id.playerId",
+			"sniperId":   "$_id.sniperId",
+			"snipes":     1,
+			"medalsLost": 1,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rivalries := []Rivalry{}
+	if err = cursor.All(ctx, &rivalries); err != nil {
+		return nil, err
+	}
+	return rivalries, nil
+}
+
+// Return whether the player lost medals on a leaderboard to another player before the timestamp
+func (mongoStore) WasSniped(ctx context.Context, track *Track, platform int, region string, playerId string, leaderboardId string, before int64) (bool, error) {
+	count, err := CountDocuments(ctx, track.Changes, bson.M{
+		"platform":                 platform,
+		"region":                   region,
+		"playerId":                 playerId,
+		"responsibleLeaderboardId": leaderboardId,
+		"responsiblePlayerId":      bson.M{"$ne": playerId},
+		"medalChange":              bson.M{"$lt": 0},
+		"timestamp":                bson.M{"$lte": before},
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Fetch every change where the player gained medals from their own score, oldest first
+func (mongoStore) GetPlayerGains(ctx context.Context, track *Track, platform int, region string, playerId string) ([]Change, error) {
+	var changes []Change
+	if err := FetchDocuments(ctx, track.Changes, bson.M{
+		"platform":            platform,
+		"region":              region,
+		"playerId":            playerId,
+		"responsiblePlayerId": playerId,
+		"medalChange":         bson.M{"$gt": 0},
+	}, &changes, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})); err != nil {
+		return []Change{}, err
+	}
+	return changes, nil
+}
+
+// Fetch a page of the clans ordered by the combined medals of their members in a region
+func (mongoStore) GetClanStandings(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[ClanStanding], error) {
+	sort := clanMedalSort
+	// Rank by number of first places, using medals to break ties
+	if sortBy == SortByFirsts {
+		sort = clanFirstsSort
+	}
+	cursor, err := decodeCursor(request.Cursor, sort)
+	if err != nil {
+		return Page[ClanStanding]{}, err
+	}
+	filter := bson.M{
+		"platform": platform,
+		"region":   region,
+		"clan":     bson.M{"$nin": bson.A{"", nil}},
+	}
+	var total *int64
+	if request.IncludeTotal {
+		var counts []struct {
+			Total int64 `bson:"total"`
+		}
+		if err = AggregateDocuments(ctx, track.Players, bson.A{
+			bson.M{"$match": filter},
+			bson.M{"$group": bson.M{"_id": "$clan"}},
+			bson.M{"$count": "total"},
+		}, &counts); err != nil {
+			return Page[ClanStanding]{}, err
+		}
+		// Nothing is counted when there are no clans
+		total = new(int64)
+		if len(counts) > 0 {
+			*total = counts[0].Total
+		}
+	}
+	// The clans are only totalled once grouped, so the cursor is matched against the totals
+	keyset := bson.M{}
+	addKeysetFilter(keyset, sort, cursor)
+	standings, err := aggregateClanStandings(ctx, track, filter, bson.M{"$match": keyset}, bson.M{"$sort": sortFor(sort, cursor)}, bson.M{"$limit": request.limit() + 1})
+	if err != nil {
+		return Page[ClanStanding]{}, err
+	}
+	page := buildPage(standings, request, cursor, func(standing ClanStanding) []any {
+		if sortBy == SortByFirsts {
+			return []any{int64(standing.Firsts), int64(standing.Medals), standing.Clan}
+		}
+		return []any{int64(standing.Medals), standing.Clan}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Fetch the combined standing of a single clan in a region
+func (mongoStore) GetClanStanding(ctx context.Context, track *Track, platform int, region string, clan string) (ClanStanding, error) {
+	standings, err := aggregateClanStandings(ctx, track, bson.M{
+		"platform": platform,
+		"region":   region,
+		"clan":     clan,
+	})
+	if err != nil || len(standings) == 0 {
+		return ClanStanding{Clan: clan}, err
+	}
+	return standings[0], nil
+}
+
+func aggregateClanStandings(ctx context.Context, track *Track, filter bson.M, stages ...bson.M) ([]ClanStanding, error) {
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$group": bson.M{
+			"_id":     "$clan",
+			"medals":  bson.M{"$sum": "$medals"},
+			"firsts":  bson.M{"$sum": "$positions.1"},
+			"members": bson.M{"$sum": 1},
+		}},
+	}
+	for _, stage := range stages {
+		pipeline = append(pipeline, stage)
+	}
+	var standings []ClanStanding
+	if err := AggregateDocuments(ctx, track.Players, pipeline, &standings); err != nil {
+		return []ClanStanding{}, err
+	}
+	return standings, nil
+}
+
+// Fetch a page of the members of a clan holding medals in a region, ordered by medals
+func (mongoStore) GetClanMembers(ctx context.Context, track *Track, platform int, region string, clan string, request PageRequest) (Page[Player], error) {
+	return fetchPage(ctx, track.Players, bson.M{
+		"platform": platform,
+		"region":   region,
+		"clan":     clan,
+	}, request, medalHolderSort, func(player Player) []any {
+		return []any{int64(player.Medals), player.PlayerId}
+	})
+}
+
+// Return the clan each of the players is in, players without a clan are left out
+func (mongoStore) GetPlayerClans(ctx context.Context, track *Track, platform int, playerIds []string) (map[string]string, error) {
+	var players []Player
+	if err := FetchDocuments(ctx, track.Players, bson.M{
+		"platform": platform,
+		"playerId": bson.M{"$in": playerIds},
+		"clan":     bson.M{"$nin": bson.A{"", nil}},
+	}, &players, options.Find().SetProjection(bson.M{"playerId": 1, "clan": 1})); err != nil {
+		return nil, err
+	}
+	clans := make(map[string]string, len(players))
+	for _, player := range players {
+		clans[player.PlayerId] = player.Clan
+	}
+	return clans, nil
+}
@@ -0,0 +1,253 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// The number of results in a page when no limit is requested, and the most a page can hold
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 100
+)
+
+// Returned when a cursor can't be decoded, or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// A request for a page of results
+type PageRequest struct {
+	// The cursor from a previous page, or empty for the first page
+	Cursor string
+	// The number of results to return, DefaultPageLimit if 0
+	Limit int
+	// Whether to count every result across all pages, which costs an extra query
+	IncludeTotal bool
+}
+
+// A page of results, with cursors to the neighbouring pages
+type Page[T any] struct {
+	Items []T
+	// The cursor to the following page, or empty if this is the last page
+	Next string
+	// The cursor to the preceding page, or empty if this is the first page
+	Prev string
+	// The number of results across all pages, only counted when requested
+	Total *int64
+}
+
+// Return the number of results the page should hold
+func (request PageRequest) limit() int {
+	if request.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	return min(request.Limit, MaxPageLimit)
+}
+
+// A field results are sorted by, named both as a document field and as a SQLite column
+type sortKey struct {
+	field      string
+	column     string
+	descending bool
+}
+
+// The orders paged results are returned in, the last key of each is unique among the results
+var (
+	// A player's scores, newest first
+	playerScoreSort = []sortKey{{field: "timestamp", column: "standings.timestamp", descending: true}, {field: "leaderboardId", column: "standings.leaderboard_id"}}
+	// A player's changes, in the order they were recorded
+	changeSort = []sortKey{{field: "timestamp", column: "timestamp"}, {field: "responsibleScoreId", column: "responsible_score_id"}}
+	// Medal holders, most medals first
+	medalHolderSort = []sortKey{{field: "medals", column: "medals", descending: true}, {field: "playerId", column: "player_id"}}
+	// Medal holders, most first places first, using medals to break ties
+	firstsHolderSort = []sortKey{
+		{field: "firsts", column: `COALESCE(json_extract(positions, '$."1"'), 0)`, descending: true},
+		{field: "medals", column: "medals", descending: true},
+		{field: "playerId", column: "player_id"},
+	}
+	// Archived season standings, by final rank
+	seasonStandingSort = []sortKey{{field: "rank"}, {field: "playerId"}}
+	// A player's rank changes, newest first
+	rankChangeSort = []sortKey{{field: "timestamp", descending: true}, {field: "responsibleLeaderboardId"}}
+	// Clans, most combined medals first
+	clanMedalSort = []sortKey{{field: "medals", column: "medals", descending: true}, {field: "_id", column: "clan"}}
+	// Clans, most combined first places first, using medals to break ties
+	clanFirstsSort = []sortKey{
+		{field: "firsts", column: "firsts", descending: true},
+		{field: "medals", column: "medals", descending: true},
+		{field: "_id", column: "clan"},
+	}
+	// The players who have sniped a player, most medals taken first
+	snipedBySort = []sortKey{{field: "medalsLost", descending: true}, {field: "snipes", descending: true}, {field: "sniperId"}}
+	// The players a player has sniped, most medals taken first
+	snipedSort = []sortKey{{field: "medalsLost", descending: true}, {field: "snipes", descending: true}, {field: "playerId"}}
+	// A player's achievements, in the order they were awarded
+	achievementSort = []sortKey{{field: "timestamp"}, {field: "achievementId"}}
+	// A player's previous bests on a leaderboard, oldest first
+	scoreHistorySort = []sortKey{{field: "timestamp"}, {field: "archivedAt"}}
+)
+
+// The decoded position of a cursor, the sort values of the result it was issued from
+type pageCursor struct {
+	Backward bool  `json:"b,omitempty"`
+	Values   []any `json:"v"`
+}
+
+// Decode an opaque cursor, checking it holds a value for every sort key
+//
+// An empty cursor decodes to the start of the first page
+func decodeCursor(encoded string, keys []sortKey) (pageCursor, error) {
+	if encoded == "" {
+		return pageCursor{}, nil
+	}
+	contents, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(contents))
+	decoder.UseNumber()
+	var cursor pageCursor
+	if err = decoder.Decode(&cursor); err != nil || len(cursor.Values) != len(keys) {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	// Every sort value is either a whole number or a string
+	for i, value := range cursor.Values {
+		switch value := value.(type) {
+		case json.Number:
+			number, err := value.Int64()
+			if err != nil {
+				return pageCursor{}, ErrInvalidCursor
+			}
+			cursor.Values[i] = number
+		case string:
+		default:
+			return pageCursor{}, ErrInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+func encodeCursor(backward bool, values []any) string {
+	contents, _ := json.Marshal(pageCursor{Backward: backward, Values: values})
+	return base64.RawURLEncoding.EncodeToString(contents)
+}
+
+// Build a page from the results of a query that fetched one more than the limit, in the direction of the cursor
+//
+// valuesOf returns a result's value for each sort key, which the neighbouring cursors are built from
+func buildPage[T any](items []T, request PageRequest, cursor pageCursor, valuesOf func(T) []any) Page[T] {
+	hasMore := len(items) > request.limit()
+	if hasMore {
+		items = items[:request.limit()]
+	}
+	// Backward queries fetch the results in reverse
+	if cursor.Backward {
+		slices.Reverse(items)
+	}
+	page := Page[T]{Items: items}
+	if len(items) == 0 {
+		// Nothing is left in this direction, but the results we came from are still there
+		if cursor.Values != nil {
+			if cursor.Backward {
+				page.Next = encodeCursor(false, cursor.Values)
+			} else {
+				page.Prev = encodeCursor(true, cursor.Values)
+			}
+		}
+		return page
+	}
+	first := valuesOf(items[0])
+	last := valuesOf(items[len(items)-1])
+	if cursor.Backward {
+		page.Next = encodeCursor(false, last)
+		if hasMore {
+			page.Prev = encodeCursor(true, first)
+		}
+	} else {
+		if hasMore {
+			page.Next = encodeCursor(false, last)
+		}
+		if cursor.Values != nil {
+			page.Prev = encodeCursor(true, first)
+		}
+	}
+	return page
+}
+
+// Return the sort for a page, reversed when paging backward
+func sortFor(keys []sortKey, cursor pageCursor) bson.D {
+	sort := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		direction := 1
+		if key.descending != cursor.Backward {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: key.field, Value: direction})
+	}
+	return sort
+}
+
+// Add the conditions matching every result past the cursor, in the direction of the cursor
+//
+// Nothing is added for the first page
+func addKeysetFilter(filter bson.M, keys []sortKey, cursor pageCursor) {
+	if cursor.Values == nil {
+		return
+	}
+	// Match results past the cursor on the first key, or equal to it and past it on a later key
+	alternatives := bson.A{}
+	for i, key := range keys {
+		alternative := bson.M{}
+		for j := range i {
+			alternative[keys[j].field] = cursor.Values[j]
+		}
+		operator := "$gt"
+		if key.descending != cursor.Backward {
+			operator = "$lt"
+		}
+		alternative[key.field] = bson.M{operator: cursor.Values[i]}
+		alternatives = append(alternatives, alternative)
+	}
+	filter["$or"] = alternatives
+}
+
+// Count the results across all pages if the request asks for a total
+func countTotal(ctx context.Context, collection *mongo.Collection, filter bson.M, request PageRequest) (*int64, error) {
+	if !request.IncludeTotal {
+		return nil, nil
+	}
+	total, err := CountDocuments(ctx, collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	return &total, nil
+}
+
+// Fetch a page of the documents in a collection matching the filter, in the provided sort order
+//
+// valuesOf returns a document's value for each sort key, as for buildPage
+func fetchPage[T any](ctx context.Context, collection *mongo.Collection, filter bson.M, request PageRequest, keys []sortKey, valuesOf func(T) []any) (Page[T], error) {
+	cursor, err := decodeCursor(request.Cursor, keys)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	total, err := countTotal(ctx, collection, filter, request)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	addKeysetFilter(filter, keys, cursor)
+	var items []T
+	if err = FetchDocuments(ctx, collection, filter, &items, options.Find().SetSort(sortFor(keys, cursor)).SetLimit(int64(request.limit()+1))); err != nil {
+		return Page[T]{}, err
+	}
+	page := buildPage(items, request, cursor, valuesOf)
+	page.Total = total
+	return page, nil
+}
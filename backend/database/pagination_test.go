@@ -0,0 +1,76 @@
+package database
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	cursor, err := decodeCursor(encodeCursor(true, []any{int64(1 << 60), "player"}), medalHolderSort)
+	if err != nil || !cursor.Backward || !slices.Equal(cursor.Values, []any{int64(1 << 60), "player"}) {
+		t.Fatalf("decoding an encoded cursor returned %+v (%v)", cursor, err)
+	}
+	for _, encoded := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte(`[1, "a"]`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"v":[1]}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"v":[1.5,"a"]}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"v":[true,"a"]}`)),
+	} {
+		if _, err = decodeCursor(encoded, medalHolderSort); err != ErrInvalidCursor {
+			t.Errorf("decoding %q returned %v, expected %v", encoded, err, ErrInvalidCursor)
+		}
+	}
+}
+
+// Walk every page of a sorted list forward then back again, querying it as the stores do
+func TestBuildPage(t *testing.T) {
+	results := []int{1, 2, 3, 4, 5}
+	request := PageRequest{Limit: 2}
+	valuesOf := func(result int) []any { return []any{int64(result)} }
+	fetch := func(encoded string) Page[int] {
+		cursor, err := decodeCursor(encoded, []sortKey{{field: "value"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Fetch one more than the limit past the cursor, in the direction of the cursor
+		var fetched []int
+		for i := range results {
+			result := results[i]
+			if cursor.Backward {
+				result = results[len(results)-1-i]
+			}
+			if cursor.Values != nil {
+				from := cursor.Values[0].(int64)
+				if cursor.Backward && int64(result) >= from || !cursor.Backward && int64(result) <= from {
+					continue
+				}
+			}
+			if fetched = append(fetched, result); len(fetched) > request.limit() {
+				break
+			}
+		}
+		return buildPage(fetched, request, cursor, valuesOf)
+	}
+	expected := [][]int{{1, 2}, {3, 4}, {5}}
+	page := fetch("")
+	for i, items := range expected {
+		if !slices.Equal(page.Items, items) || (i == 0) != (page.Prev == "") || (i == len(expected)-1) != (page.Next == "") {
+			t.Fatalf("page %d going forward returned %+v, expected %v", i+1, page, items)
+		}
+		if page.Next != "" {
+			page = fetch(page.Next)
+		}
+	}
+	for i := len(expected) - 2; i >= 0; i-- {
+		page = fetch(page.Prev)
+		if !slices.Equal(page.Items, expected[i]) || page.Next == "" || (i == 0) != (page.Prev == "") {
+			t.Fatalf("page %d going backward returned %+v, expected %v", i+1, page, expected[i])
+		}
+	}
+	// Paging past the end still leads back to the results before it
+	if page = fetch(encodeCursor(false, valuesOf(5))); len(page.Items) != 0 || page.Next != "" || page.Prev == "" {
+		t.Fatalf("page past the end returned %+v", page)
+	}
+}
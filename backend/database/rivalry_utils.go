@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Record a player being sniped by another player for the provided number of medals
+func RecordSnipe(ctx context.Context, platform int, region string, playerId string, sniperId string, medals int) error {
+	return UpsertDocument(ctx, Collections.Rivalries, bson.M{
+		"platform": platform,
+		"region":   region,
+		"playerId": playerId,
+		"sniperId": sniperId,
+	}, bson.M{"$inc": bson.M{"snipes": 1, "medalsLost": medals}})
+}
+
+// Fetch a page of the players who have taken the most medals from the player
+func GetSnipedBy(ctx context.Context, platform int, region string, playerId string, request PageRequest) (Page[Rivalry], error) {
+	return fetchPage(ctx, Collections.Rivalries, bson.M{
+		"platform": platform,
+		"region":   region,
+		"playerId": playerId,
+	}, request, snipedBySort, func(rivalry Rivalry) []any {
+		return []any{int64(rivalry.MedalsLost), int64(rivalry.Snipes), rivalry.SniperId}
+	})
+}
+
+// Fetch a page of the players the player has taken the most medals from
+func GetSniped(ctx context.Context, platform int, region string, playerId string, request PageRequest) (Page[Rivalry], error) {
+	return fetchPage(ctx, Collections.Rivalries, bson.M{
+		"platform": platform,
+		"region":   region,
+		"sniperId": playerId,
+	}, request, snipedSort, func(rivalry Rivalry) []any {
+		return []any{int64(rivalry.MedalsLost), int64(rivalry.Snipes), rivalry.PlayerId}
+	})
+}
+
+// Fetch the snipes exchanged between two players in a region
+func GetHeadToHead(ctx context.Context, platform int, region string, playerId string, rivalId string) (HeadToHead, error) {
+	snipedBy, err := fetchRivalry(ctx, platform, region, playerId, rivalId)
+	if err != nil {
+		return HeadToHead{}, err
+	}
+	sniped, err := fetchRivalry(ctx, platform, region, rivalId, playerId)
+	if err != nil {
+		return HeadToHead{}, err
+	}
+	return HeadToHead{
+		PlayerId:  playerId,
+		RivalId:   rivalId,
+		SnipedBy:  snipedBy,
+		Sniped:    sniped,
+		NetMedals: sniped.MedalsLost - snipedBy.MedalsLost,
+	}, nil
+}
+
+// Fetch how often a player has been sniped by another, which is empty if it's never happened
+func fetchRivalry(ctx context.Context, platform int, region string, playerId string, sniperId string) (Rivalry, error) {
+	rivalry := Rivalry{
+		Platform: platform,
+		Region:   region,
+		PlayerId: playerId,
+		SniperId: sniperId,
+	}
+	document, err := FetchDocument(ctx, Collections.Rivalries, bson.M{
+		"platform": platform,
+		"region":   region,
+		"playerId": playerId,
+		"sniperId": sniperId,
+	})
+	if err == mongo.ErrNoDocuments {
+		return rivalry, nil
+	}
+	if err != nil {
+		return Rivalry{}, err
+	}
+	if err = document.Decode(&rivalry); err != nil {
+		return Rivalry{}, err
+	}
+	return rivalry, nil
+}
+
+// Returned when rebuilding rivalries after changes have been rolled up, which no longer record each snipe
+var ErrRivalriesCompacted = errors.New("changes have been rolled up, so rivalries can no longer be rebuilt from the ledger")
+
+// Rebuild every rivalry from the lifetime changes ledger
+//
+// The rivalries are built in a separate collection which then replaces the current one, so they stay
+// readable throughout and a failure leaves them as they were. Rolled up changes no longer record each
+// snipe, so once any exist the rebuild is refused rather than losing the history they held.
+func RebuildRivalries(ctx context.Context) error {
+	if !MongoEnabled() {
+		return ErrMongoDisabled
+	}
+	compacted, err := store.HasRollups(ctx, Lifetime)
+	if err != nil {
+		return err
+	}
+	if compacted {
+		return ErrRivalriesCompacted
+	}
+	rivalries, err := store.GetSnipeTotals(ctx, Lifetime)
+	if err != nil {
+		return err
+	}
+	rebuilt := Database.Collection(Collections.Rivalries.Name() + "_rebuild")
+	if err = dropCollection(ctx, rebuilt); err != nil {
+		return err
+	}
+	if err = createCollectionIndexes(ctx, rebuilt, collectionIndexes()[Collections.Rivalries]); err != nil {
+		return err
+	}
+	for start := 0; start < len(rivalries); start += transferBatchSize {
+		batch := rivalries[start:min(start+transferBatchSize, len(rivalries))]
+		documents := make([]any, 0, len(batch))
+		for _, rivalry := range batch {
+			documents = append(documents, rivalry)
+		}
+		if err = InsertManyDocuments(ctx, rebuilt, documents); err != nil {
+			return err
+		}
+	}
+	return replaceCollection(ctx, rebuilt, Collections.Rivalries)
+}
+
+// Drop a collection along with its indexes
+func dropCollection(ctx context.Context, collection *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	return collection.Drop(ctx)
+}
+
+// Replace a collection with another in a single step, by renaming it over the top
+func replaceCollection(ctx context.Context, replacement *mongo.Collection, replaced *mongo.Collection) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	return Client.Database("admin").RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: Database.Name() + "." + replacement.Name()},
+		{Key: "to", Value: Database.Name() + "." + replaced.Name()},
+		{Key: "dropTarget", Value: true},
+	}).Err()
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// The number of responsible players kept in each rollup
+const rollupResponsibleLimit = 5
+
+// The length of the days changes are rolled up into
+const rollupDay = int64(24 * time.Hour / time.Millisecond)
+
+// The player and region a rollup belongs to
+type rollupKey struct {
+	platform int
+	region   string
+	playerId string
+}
+
+// Roll every raw change recorded before the timestamp into daily rollups, returning how many were rolled up
+//
+// Only whole days are rolled up, so the day holding the timestamp is left alone. Rolling up a day that
+// already has rollups, such as after importing older changes, folds the new changes into them.
+func RollUpChanges(ctx context.Context, track *Track, before int64) (int, error) {
+	return rollUpChanges(ctx, store, track, before)
+}
+
+func rollUpChanges(ctx context.Context, store Store, track *Track, before int64) (int, error) {
+	before -= before % rollupDay
+	rolledUp := 0
+	after := int64(0)
+	for {
+		oldest, ok, err := store.GetOldestChangeTimestamp(ctx, track, after, before)
+		if err != nil || !ok {
+			return rolledUp, err
+		}
+		day := oldest - oldest%rollupDay
+		count, err := rollUpDay(ctx, store, track, day)
+		if err != nil {
+			return rolledUp, err
+		}
+		rolledUp += count
+		// Days are rolled up oldest first, so the next raw change can't be any earlier
+		after = day + rollupDay
+	}
+}
+
+// Replace the changes recorded during a day with a rollup for each player and region
+//
+// Only the raw changes read are replaced, and any already folded into a stored rollup are deleted without
+// being counted again, so a roll up that failed partway can be repeated
+func rollUpDay(ctx context.Context, store Store, track *Track, day int64) (int, error) {
+	rollups := make(map[rollupKey]*Change)
+	responsible := make(map[rollupKey]map[string]*ResponsibleTotal)
+	rollupOf := func(change Change) (*Change, rollupKey) {
+		key := rollupKey{change.Platform, change.Region, change.PlayerId}
+		rollup, ok := rollups[key]
+		if !ok {
+			rollup = &Change{
+				Platform:  change.Platform,
+				PlayerId:  change.PlayerId,
+				Region:    change.Region,
+				Timestamp: day,
+				Reason:    ChangeReasonRollup,
+				Rollup:    &ChangeRollup{},
+			}
+			rollups[key] = rollup
+			responsible[key] = make(map[string]*ResponsibleTotal)
+		}
+		return rollup, key
+	}
+	// The raw changes are folded in once every stored rollup has been read, so we know which they already hold
+	var rawIds []string
+	var raws []Change
+	alreadyFolded := make(map[string]bool)
+	err := store.EachChangeWithId(ctx, track, day, day+rollupDay, func(id string, change Change) error {
+		if change.Rollup == nil {
+			rawIds = append(rawIds, id)
+			raws = append(raws, change)
+			return nil
+		}
+		rollup, key := rollupOf(change)
+		rollup.MedalChange += change.MedalChange
+		rollup.Achievements = append(rollup.Achievements, change.Achievements...)
+		rollup.Rollup.Gains += change.Rollup.Gains
+		rollup.Rollup.Losses += change.Rollup.Losses
+		rollup.Rollup.Changes += change.Rollup.Changes
+		rollup.Rollup.Folded = append(rollup.Rollup.Folded, change.Rollup.Folded...)
+		for _, total := range change.Rollup.TopResponsible {
+			addResponsible(responsible[key], total.PlayerId, total.MedalChange, total.Changes)
+		}
+		for _, id := range change.Rollup.Folded {
+			alreadyFolded[id] = true
+		}
+		return nil
+	})
+	// A day holding only rollups has nothing left to roll up
+	if err != nil || len(raws) == 0 {
+		return 0, err
+	}
+	rolledUp := 0
+	for i, change := range raws {
+		if alreadyFolded[rawIds[i]] {
+			continue
+		}
+		rollup, key := rollupOf(change)
+		rolledUp++
+		rollup.MedalChange += change.MedalChange
+		rollup.Achievements = append(rollup.Achievements, change.Achievements...)
+		rollup.Rollup.Folded = append(rollup.Rollup.Folded, rawIds[i])
+		if change.MedalChange > 0 {
+			rollup.Rollup.Gains += change.MedalChange
+		} else {
+			rollup.Rollup.Losses -= change.MedalChange
+		}
+		rollup.Rollup.Changes++
+		if change.ResponsiblePlayerId != "" {
+			addResponsible(responsible[key], change.ResponsiblePlayerId, change.MedalChange, 1)
+		}
+	}
+	changes := make([]Change, 0, len(rollups))
+	for key, rollup := range rollups {
+		rollup.Rollup.TopResponsible = topResponsible(responsible[key])
+		changes = append(changes, *rollup)
+	}
+	// Keep the rollups in a stable order, so rolling up the same changes always stores the same records
+	slices.SortFunc(changes, func(a, b Change) int {
+		return cmp.Or(cmp.Compare(a.Platform, b.Platform), cmp.Compare(a.Region, b.Region), cmp.Compare(a.PlayerId, b.PlayerId))
+	})
+	if err = store.CompactChanges(ctx, track, day, day+rollupDay, changes, rawIds); err != nil {
+		return 0, err
+	}
+	return rolledUp, nil
+}
+
+func addResponsible(totals map[string]*ResponsibleTotal, playerId string, medalChange int, changes int) {
+	total, ok := totals[playerId]
+	if !ok {
+		total = &ResponsibleTotal{PlayerId: playerId}
+		totals[playerId] = total
+	}
+	total.MedalChange += medalChange
+	total.Changes += changes
+}
+
+// Return the players responsible for the most medals moving, biggest net change first
+func topResponsible(totals map[string]*ResponsibleTotal) []ResponsibleTotal {
+	top := make([]ResponsibleTotal, 0, len(totals))
+	for _, total := range totals {
+		top = append(top, *total)
+	}
+	slices.SortFunc(top, func(a, b ResponsibleTotal) int {
+		return cmp.Or(cmp.Compare(abs(b.MedalChange), abs(a.MedalChange)), cmp.Compare(b.Changes, a.Changes), cmp.Compare(a.PlayerId, b.PlayerId))
+	})
+	return top[:min(len(top), rollupResponsibleLimit)]
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRollUpDay(t *testing.T) {
+	ctx := context.Background()
+	store := openTestSqliteStore(t)
+	track := &Track{Name: "rollups"}
+	day := 5 * rollupDay
+	change := func(playerId string, timestamp int64, medalChange int, responsiblePlayerId string) Change {
+		return Change{Platform: 1, PlayerId: playerId, Region: "GB", Timestamp: timestamp, MedalChange: medalChange, ResponsiblePlayerId: responsiblePlayerId, Reason: "score"}
+	}
+	rollUp := func(changes []Change, expectedRolledUp int, expected string) {
+		t.Helper()
+		if err := store.InsertChanges(ctx, track, changes); err != nil {
+			t.Fatal(err)
+		}
+		rolledUp, err := rollUpDay(ctx, store, track, day)
+		if err != nil || rolledUp != expectedRolledUp {
+			t.Fatalf("rollUpDay rolled up %d changes (%v), expected %d", rolledUp, err, expectedRolledUp)
+		}
+		var stored []string
+		if err = store.EachChange(ctx, track, ExportFilter{}, func(change Change) error {
+			if change.Rollup == nil {
+				stored = append(stored, fmt.Sprintf("%s at %d: %d", change.PlayerId, change.Timestamp, change.MedalChange))
+			} else {
+				stored = append(stored, fmt.Sprintf("%s rollup: %d %+v", change.PlayerId, change.MedalChange, *change.Rollup))
+			}
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(stored, "\n") != expected {
+			t.Fatalf("stored changes\n%s\nexpected\n%s", strings.Join(stored, "\n"), expected)
+		}
+	}
+	// Only the changes within the day are rolled up
+	rollUp([]Change{
+		change("a", day-1, 1, "x"),
+		change("a", day, 3, "x"),
+		change("a", day+1, -2, "y"),
+		change("b", day+2, 5, "a"),
+		change("a", day+rollupDay-1, 1, "x"),
+		change("a", day+rollupDay, 4, "x"),
+	}, 4, `a at 431999999: 1
+a at 518400000: 4
+a rollup: 2 {Gains:4 Losses:2 Changes:3 TopResponsible:[{PlayerId:x MedalChange:4 Changes:2} {PlayerId:y MedalChange:-2 Changes:1}] Folded:[]}
+b rollup: 5 {Gains:5 Losses:0 Changes:1 TopResponsible:[{PlayerId:a MedalChange:5 Changes:1}] Folded:[]}`)
+	// Changes recorded later fold into the day's rollups
+	rollUp([]Change{change("a", day+3, -4, "y")}, 1, `a at 431999999: 1
+a at 518400000: 4
+a rollup: -2 {Gains:4 Losses:6 Changes:4 TopResponsible:[{PlayerId:y MedalChange:-6 Changes:2} {PlayerId:x MedalChange:4 Changes:2}] Folded:[]}
+b rollup: 5 {Gains:5 Losses:0 Changes:1 TopResponsible:[{PlayerId:a MedalChange:5 Changes:1}] Folded:[]}`)
+	if compacted, err := store.HasRollups(ctx, track); err != nil || !compacted {
+		t.Fatalf("HasRollups returned %t (%v) once changes were rolled up", compacted, err)
+	}
+	// A day holding only rollups is left alone
+	rollUp(nil, 0, `a at 431999999: 1
+a at 518400000: 4
+a rollup: -2 {Gains:4 Losses:6 Changes:4 TopResponsible:[{PlayerId:y MedalChange:-6 Changes:2} {PlayerId:x MedalChange:4 Changes:2}] Folded:[]}
+b rollup: 5 {Gains:5 Losses:0 Changes:1 TopResponsible:[{PlayerId:a MedalChange:5 Changes:1}] Folded:[]}`)
+}
@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Fetch a page of the previous bests a player has set on a leaderboard in a region, oldest first
+func GetScoreHistory(ctx context.Context, platform int, region string, playerId string, leaderboardId string, request PageRequest) (Page[ArchivedScore], error) {
+	return fetchPage(ctx, Collections.ScoreHistory, bson.M{
+		"platform":      platform,
+		"region":        region,
+		"playerId":      playerId,
+		"leaderboardId": leaderboardId,
+	}, request, scoreHistorySort, func(score ArchivedScore) []any {
+		return []any{score.Timestamp, score.ArchivedAt}
+	})
+}
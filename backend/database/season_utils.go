@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Fetch a season from the database
+func GetSeason(ctx context.Context, seasonId string) (Season, error) {
+	document, err := FetchDocument(ctx, Collections.Seasons, bson.M{"seasonId": seasonId})
+	if err != nil {
+		return Season{}, err
+	}
+	var season Season
+	if err = document.Decode(&season); err != nil {
+		return Season{}, err
+	}
+	return season, nil
+}
+
+// Fetch every season, most recent first
+func GetSeasons(ctx context.Context) ([]Season, error) {
+	var seasons []Season
+	if err := FetchDocuments(ctx, Collections.Seasons, bson.M{}, &seasons, options.Find().SetSort(bson.D{{Key: "start", Value: -1}})); err != nil {
+		return []Season{}, err
+	}
+	return seasons, nil
+}
+
+// Fetch every season that has ended but not yet been archived
+func GetUnarchivedSeasons(ctx context.Context, now int64) ([]Season, error) {
+	var seasons []Season
+	if err := FetchDocuments(ctx, Collections.Seasons, bson.M{
+		"archived": false,
+		"end":      bson.M{"$lte": now},
+	}, &seasons); err != nil {
+		return []Season{}, err
+	}
+	return seasons, nil
+}
+
+// Fetch a page of a season's archived final standings for a region
+func GetSeasonStandings(ctx context.Context, seasonId string, platform int, region string, request PageRequest) (Page[SeasonStanding], error) {
+	cursor, err := decodeCursor(request.Cursor, seasonStandingSort)
+	if err != nil {
+		return Page[SeasonStanding]{}, err
+	}
+	filter := bson.M{
+		"seasonId": seasonId,
+		"platform": platform,
+		"region":   region,
+	}
+	total, err := countTotal(ctx, Collections.SeasonStandings, filter, request)
+	if err != nil {
+		return Page[SeasonStanding]{}, err
+	}
+	addKeysetFilter(filter, seasonStandingSort, cursor)
+	var standings []SeasonStanding
+	if err := FetchDocuments(ctx, Collections.SeasonStandings, filter, &standings, options.Find().SetSort(sortFor(seasonStandingSort, cursor)).SetLimit(int64(request.limit()+1))); err != nil {
+		return Page[SeasonStanding]{}, err
+	}
+	page := buildPage(standings, request, cursor, func(standing SeasonStanding) []any {
+		return []any{int64(standing.Rank), standing.PlayerId}
+	})
+	page.Total = total
+	return page, nil
+}
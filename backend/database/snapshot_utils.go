@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Return when the most recent snapshot was taken, or 0 if none have been taken
+func GetLatestSnapshotTimestamp(ctx context.Context) (int64, error) {
+	document, err := FetchDocument(ctx, Collections.Snapshots, bson.M{}, options.FindOne().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetProjection(bson.M{"timestamp": 1}))
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var snapshot Snapshot
+	if err = document.Decode(&snapshot); err != nil {
+		return 0, err
+	}
+	return snapshot.Timestamp, nil
+}
+
+// Fetch the most recent snapshot of a region taken at or before the timestamp
+//
+// A timestamp of 0 will fetch the most recent snapshot
+func GetSnapshotAt(ctx context.Context, platform int, region string, timestamp int64) (Snapshot, error) {
+	filter := bson.M{
+		"platform": platform,
+		"region":   region,
+	}
+	if timestamp != 0 {
+		filter["timestamp"] = bson.M{"$lte": timestamp}
+	}
+	document, err := FetchDocument(ctx, Collections.Snapshots, filter, options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}}))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snapshot Snapshot
+	if err = document.Decode(&snapshot); err != nil {
+		return Snapshot{}, err
+	}
+	return snapshot, nil
+}
+
+// Fetch a player's rank and medals from every snapshot of a region, oldest first
+func GetPlayerHistory(ctx context.Context, platform int, region string, playerId string, before int64, after int64) ([]PlayerHistoryPoint, error) {
+	filter := bson.M{
+		"platform":  platform,
+		"region":    region,
+		"entries.p": playerId,
+	}
+	// Add the before and after filters
+	if before != 0 || after != 0 {
+		timestamp := bson.M{}
+		if before != 0 {
+			timestamp["$lte"] = before
+		}
+		if after != 0 {
+			timestamp["$gte"] = after
+		}
+		filter["timestamp"] = timestamp
+	}
+	// Only pull the player's own entry out of each snapshot
+	var history []PlayerHistoryPoint
+	if err := AggregateDocuments(ctx, Collections.Snapshots, bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$sort": bson.M{"timestamp": 1}},
+		bson.M{"$unwind": "$entries"},
+		bson.M{"$match": bson.M{"entries.p": playerId}},
+		bson.M{"$project": bson.M{
+			"_id":       0,
+			"timestamp": 1,
+			"rank":      "$entries.r",
+			"medals":    "$entries.m",
+		}},
+	}, &history); err != nil {
+		return []PlayerHistoryPoint{}, err
+	}
+	return history, nil
+}
@@ -0,0 +1,1184 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// The schema of the SQLite store, every track shares the same tables
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scores (
+	track          TEXT    NOT NULL,
+	platform       INTEGER NOT NULL,
+	score_id       TEXT    NOT NULL,
+	player_id      TEXT    NOT NULL,
+	leaderboard_id TEXT    NOT NULL,
+	score          INTEGER NOT NULL,
+	max_score      INTEGER NOT NULL,
+	timestamp      INTEGER NOT NULL,
+	modifiers      TEXT    NOT NULL,
+	bad_cuts       INTEGER NOT NULL,
+	missed_notes   INTEGER NOT NULL,
+	full_combo     INTEGER NOT NULL,
+	max_combo      INTEGER NOT NULL,
+	PRIMARY KEY (track, platform, score_id)
+);
+CREATE INDEX IF NOT EXISTS scores_player ON scores (track, platform, player_id, leaderboard_id);
+CREATE TABLE IF NOT EXISTS standings (
+	track          TEXT    NOT NULL,
+	platform       INTEGER NOT NULL,
+	leaderboard_id TEXT    NOT NULL,
+	region         TEXT    NOT NULL,
+	position       INTEGER NOT NULL,
+	score_id       TEXT    NOT NULL,
+	player_id      TEXT    NOT NULL,
+	score          INTEGER NOT NULL,
+	timestamp      INTEGER NOT NULL,
+	PRIMARY KEY (track, platform, leaderboard_id, region, player_id)
+);
+CREATE INDEX IF NOT EXISTS standings_leaderboard ON standings (track, platform, leaderboard_id, region, position);
+CREATE INDEX IF NOT EXISTS standings_player ON standings (track, platform, region, player_id, timestamp DESC, leaderboard_id);
+CREATE INDEX IF NOT EXISTS standings_score ON standings (track, platform, score_id);
+CREATE INDEX IF NOT EXISTS standings_held ON standings (track, platform, player_id);
+CREATE TABLE IF NOT EXISTS players (
+	track     TEXT    NOT NULL,
+	platform  INTEGER NOT NULL,
+	region    TEXT    NOT NULL,
+	player_id TEXT    NOT NULL,
+	username  TEXT    NOT NULL,
+	medals    INTEGER NOT NULL,
+	positions TEXT    NOT NULL,
+	avatar           TEXT    NOT NULL DEFAULT '',
+	country          TEXT    NOT NULL DEFAULT '',
+	pp               REAL    NOT NULL DEFAULT 0,
+	rank             INTEGER NOT NULL DEFAULT 0,
+	role             TEXT    NOT NULL DEFAULT '',
+	clan             TEXT    NOT NULL DEFAULT '',
+	username_history TEXT    NOT NULL DEFAULT '[]',
+	country_history  TEXT    NOT NULL DEFAULT '[]',
+	PRIMARY KEY (track, platform, region, player_id)
+);
+CREATE INDEX IF NOT EXISTS players_medals ON players (track, platform, region, medals DESC, player_id);
+CREATE TABLE IF NOT EXISTS changes (
+	id                         INTEGER PRIMARY KEY AUTOINCREMENT,
+	track                      TEXT    NOT NULL,
+	platform                   INTEGER NOT NULL,
+	player_id                  TEXT    NOT NULL,
+	region                     TEXT    NOT NULL,
+	timestamp                  INTEGER NOT NULL,
+	medal_change               INTEGER NOT NULL,
+	responsible_leaderboard_id TEXT    NOT NULL,
+	responsible_player_id      TEXT    NOT NULL,
+	responsible_score_id       TEXT    NOT NULL,
+	reason                     TEXT    NOT NULL,
+	achievements               TEXT    NOT NULL,
+	rollup                     TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS changes_player ON changes (track, platform, region, player_id, timestamp, responsible_score_id);
+CREATE INDEX IF NOT EXISTS changes_timestamp ON changes (track, timestamp);
+`
+
+// Columns added since the schema was first released, which files created before them are missing
+var sqliteAddedColumns = []string{
+	"ALTER TABLE changes ADD COLUMN rollup TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE players ADD COLUMN avatar TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE players ADD COLUMN country TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE players ADD COLUMN pp REAL NOT NULL DEFAULT 0",
+	"ALTER TABLE players ADD COLUMN rank INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE players ADD COLUMN role TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE players ADD COLUMN clan TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE players ADD COLUMN username_history TEXT NOT NULL DEFAULT '[]'",
+	"ALTER TABLE players ADD COLUMN country_history TEXT NOT NULL DEFAULT '[]'",
+}
+
+// Indexes on columns added since the schema was first released, created once the columns exist
+const sqliteAddedIndexes = `
+CREATE INDEX IF NOT EXISTS players_clan ON players (track, platform, region, clan);
+`
+
+// The columns selected for each kind of row, in the order they are scanned
+const (
+	scoreColumns    = "score_id, player_id, leaderboard_id, platform, score, max_score, timestamp, modifiers, bad_cuts, missed_notes, full_combo, max_combo"
+	standingColumns = "platform, leaderboard_id, region, position, score_id, player_id, score, timestamp"
+	playerColumns   = "player_id, platform, region, medals, username, positions, avatar, country, pp, rank, role, clan, username_history, country_history"
+	changeColumns   = "platform, player_id, region, timestamp, medal_change, responsible_leaderboard_id, responsible_player_id, responsible_score_id, reason, achievements, rollup"
+)
+
+// The query totalling the medals, first places and members of each clan in a region, to be grouped by clan
+const clanTotals = `SELECT clan, SUM(medals) AS medals, SUM(COALESCE(json_extract(positions, '$."1"'), 0)) AS firsts, COUNT(*) AS members
+	FROM players WHERE track = ? AND platform = ? AND region = ?`
+
+// The store keeping every track's standings, players and changes in a single SQLite file
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Open the SQLite database at the provided path, creating the schema if needed
+func openSqliteStore(ctx context.Context, path string) (*sqliteStore, error) {
+	// Other processes may be writing to the same file, so wait for them rather than fail with busy errors
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, so share one connection rather than fail with busy errors
+	db.SetMaxOpenConns(1)
+	if _, err = db.ExecContext(ctx, sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, statement := range sqliteAddedColumns {
+		if _, err = db.ExecContext(ctx, statement); err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			db.Close()
+			return nil, err
+		}
+	}
+	if _, err = db.ExecContext(ctx, sqliteAddedIndexes); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// Fetch a score from the database
+func (s *sqliteStore) GetScore(ctx context.Context, track *Track, platform int, scoreId string) (Score, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	row := s.db.QueryRowContext(ctx, "SELECT "+scoreColumns+" FROM scores WHERE track = ? AND platform = ? AND score_id = ?", track.Name, platform, scoreId)
+	score, err := scanScore(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Score{}, ErrNotFound
+	}
+	return score, err
+}
+
+// Fetch a page of a player's scores from the database, newest first
+func (s *sqliteStore) GetPlayerScores(ctx context.Context, track *Track, player *Player, request PageRequest, before int64, after int64) (Page[Score], error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	cursor, err := decodeCursor(request.Cursor, playerScoreSort)
+	if err != nil {
+		return Page[Score]{}, err
+	}
+	// Find the player's standings in the region, then the scores holding them
+	from := ` FROM standings JOIN scores ON scores.track = standings.track AND scores.platform = standings.platform AND scores.score_id = standings.score_id
+		WHERE standings.track = ? AND standings.platform = ? AND standings.player_id = ? AND standings.region = ?`
+	args := []any{track.Name, player.Platform, player.PlayerId, player.Region}
+	from, args = withTimestampRange(from, args, "standings.timestamp", before, after)
+	total, err := s.countTotal(ctx, from, args, request)
+	if err != nil {
+		return Page[Score]{}, err
+	}
+	from, args = withKeyset(from, args, playerScoreSort, cursor)
+	scores, err := s.queryScores(ctx, `SELECT scores.score_id, scores.player_id, scores.leaderboard_id, scores.platform, scores.score, scores.max_score, scores.timestamp,
+		scores.modifiers, scores.bad_cuts, scores.missed_notes, scores.full_combo, scores.max_combo`+from+orderFor(playerScoreSort, cursor)+" LIMIT ?",
+		append(args, request.limit()+1)...)
+	if err != nil {
+		return Page[Score]{}, err
+	}
+	page := buildPage(scores, request, cursor, func(score Score) []any {
+		return []any{score.Timestamp, score.LeaderboardId}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Fetch a page of a player's changes from the database, in the order they were recorded
+func (s *sqliteStore) GetChanges(ctx context.Context, track *Track, platform int, region string, playerId string, request PageRequest, before int64, after int64) (Page[Change], error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	cursor, err := decodeCursor(request.Cursor, changeSort)
+	if err != nil {
+		return Page[Change]{}, err
+	}
+	from := " FROM changes WHERE track = ? AND platform = ? AND player_id = ? AND region = ?"
+	args := []any{track.Name, platform, playerId, region}
+	from, args = withTimestampRange(from, args, "timestamp", before, after)
+	total, err := s.countTotal(ctx, from, args, request)
+	if err != nil {
+		return Page[Change]{}, err
+	}
+	from, args = withKeyset(from, args, changeSort, cursor)
+	rows, err := s.db.QueryContext(ctx, "SELECT "+changeColumns+from+orderFor(changeSort, cursor)+" LIMIT ?", append(args, request.limit()+1)...)
+	if err != nil {
+		return Page[Change]{}, err
+	}
+	defer rows.Close()
+	changes := []Change{}
+	for rows.Next() {
+		change, err := scanChange(rows.Scan)
+		if err != nil {
+			return Page[Change]{}, err
+		}
+		changes = append(changes, change)
+	}
+	if err = rows.Err(); err != nil {
+		return Page[Change]{}, err
+	}
+	page := buildPage(changes, request, cursor, func(change Change) []any {
+		return []any{change.Timestamp, change.ResponsibleScoreId}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Return whether the provided score is within the top scores tracked for that leaderboard
+func (s *sqliteStore) IsWithinTopTen(ctx context.Context, track *Track, platform int, leaderboardId string, region string, score int, depth int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	var lowest int
+	err := s.db.QueryRowContext(ctx, "SELECT score FROM standings WHERE track = ? AND platform = ? AND leaderboard_id = ? AND region = ? ORDER BY position LIMIT 1 OFFSET ?",
+		track.Name, platform, leaderboardId, region, depth-1).Scan(&lowest)
+	// The leaderboard isn't full, so any score is within it
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return score > lowest, nil
+}
+
+// Get the standings of a leaderboard in a region, best first, up to the provided limit
+func (s *sqliteStore) GetStandings(ctx context.Context, track *Track, platform int, region string, leaderboardId string, limit int64) ([]Standing, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, "SELECT "+standingColumns+" FROM standings WHERE track = ? AND platform = ? AND region = ? AND leaderboard_id = ? ORDER BY position LIMIT ?",
+		track.Name, platform, region, leaderboardId, limit)
+	if err != nil {
+		return []Standing{}, err
+	}
+	defer rows.Close()
+	standings := []Standing{}
+	for rows.Next() {
+		var standing Standing
+		if err = rows.Scan(&standing.Platform, &standing.LeaderboardId, &standing.Region, &standing.Position,
+			&standing.ScoreId, &standing.PlayerId, &standing.Score, &standing.Timestamp); err != nil {
+			return []Standing{}, err
+		}
+		standings = append(standings, standing)
+	}
+	return standings, rows.Err()
+}
+
+func (s *sqliteStore) GetPlayerStandings(ctx context.Context, track *Track, platform int, playerId string) ([]Standing, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, "SELECT "+standingColumns+" FROM standings WHERE track = ? AND platform = ? AND player_id = ? ORDER BY leaderboard_id, region",
+		track.Name, platform, playerId)
+	if err != nil {
+		return []Standing{}, err
+	}
+	defer rows.Close()
+	standings := []Standing{}
+	for rows.Next() {
+		var standing Standing
+		if err = rows.Scan(&standing.Platform, &standing.LeaderboardId, &standing.Region, &standing.Position,
+			&standing.ScoreId, &standing.PlayerId, &standing.Score, &standing.Timestamp); err != nil {
+			return []Standing{}, err
+		}
+		standings = append(standings, standing)
+	}
+	return standings, rows.Err()
+}
+
+// Replace the standings of a leaderboard in a region
+func (s *sqliteStore) SetStandings(ctx context.Context, track *Track, platform int, leaderboardId string, region string, standings []Standing) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+	if _, err = transaction.ExecContext(ctx, "DELETE FROM standings WHERE track = ? AND platform = ? AND leaderboard_id = ? AND region = ?",
+		track.Name, platform, leaderboardId, region); err != nil {
+		return err
+	}
+	for _, standing := range standings {
+		if _, err = transaction.ExecContext(ctx, "INSERT INTO standings (track, "+standingColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			track.Name, standing.Platform, standing.LeaderboardId, standing.Region, standing.Position,
+			standing.ScoreId, standing.PlayerId, standing.Score, standing.Timestamp); err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+// Get every standing of the most recently scored leaderboard regions, up to the provided number of regions
+//
+// The standings are grouped by leaderboard region, best first within each
+func (s *sqliteStore) GetRecentStandings(ctx context.Context, track *Track, limit int) ([]Standing, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, "SELECT "+standingColumns+` FROM standings
+		WHERE track = ? AND (platform, leaderboard_id, region) IN (
+			SELECT platform, leaderboard_id, region FROM standings WHERE track = ?
+			GROUP BY platform, leaderboard_id, region ORDER BY MAX(timestamp) DESC LIMIT ?)
+		ORDER BY platform, leaderboard_id, region, position`,
+		track.Name, track.Name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var standings []Standing
+	for rows.Next() {
+		var standing Standing
+		if err = rows.Scan(&standing.Platform, &standing.LeaderboardId, &standing.Region, &standing.Position,
+			&standing.ScoreId, &standing.PlayerId, &standing.Score, &standing.Timestamp); err != nil {
+			return nil, err
+		}
+		standings = append(standings, standing)
+	}
+	return standings, rows.Err()
+}
+
+// Get a page of the medal holders for a region
+func (s *sqliteStore) GetTopTenMedalHolders(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[Player], error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	sort := medalHolderSort
+	if sortBy == SortByFirsts {
+		sort = firstsHolderSort
+	}
+	cursor, err := decodeCursor(request.Cursor, sort)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	from := " FROM players WHERE track = ? AND platform = ? AND region = ?"
+	args := []any{track.Name, platform, region}
+	total, err := s.countTotal(ctx, from, args, request)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	from, args = withKeyset(from, args, sort, cursor)
+	players, err := s.queryPlayers(ctx, "SELECT "+playerColumns+from+orderFor(sort, cursor)+" LIMIT ?", append(args, request.limit()+1)...)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	page := buildPage(players, request, cursor, func(player Player) []any {
+		if sortBy == SortByFirsts {
+			return []any{int64(player.Positions["1"]), int64(player.Medals), player.PlayerId}
+		}
+		return []any{int64(player.Medals), player.PlayerId}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Fetch a player from the database, optionally creating one if they don't exist
+func (s *sqliteStore) GetPlayer(ctx context.Context, track *Track, platform int, region string, playerId string, username string, createIfAbsent bool) (*Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	if createIfAbsent {
+		// Only the first insert creates the player, so concurrent scores can't create them twice
+		if _, err := s.db.ExecContext(ctx, "INSERT OR IGNORE INTO players (track, platform, region, player_id, username, medals, positions) VALUES (?, ?, ?, ?, ?, 0, '{}')",
+			track.Name, platform, region, playerId, username); err != nil {
+			return nil, err
+		}
+	}
+	players, err := s.queryPlayers(ctx, "SELECT "+playerColumns+" FROM players WHERE track = ? AND platform = ? AND region = ? AND player_id = ?",
+		track.Name, platform, region, playerId)
+	if err != nil {
+		return nil, err
+	}
+	if len(players) == 0 {
+		return nil, ErrNotFound
+	}
+	return &players[0], nil
+}
+
+// Fetch every score a player has stored on the platform, regardless of region
+func (s *sqliteStore) GetAllPlayerScores(ctx context.Context, track *Track, platform int, playerId string) ([]Score, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	return s.queryScores(ctx, "SELECT "+scoreColumns+" FROM scores WHERE track = ? AND platform = ? AND player_id = ? ORDER BY rowid",
+		track.Name, platform, playerId)
+}
+
+// Fetch the scores a player has stored on a leaderboard
+func (s *sqliteStore) GetLeaderboardScores(ctx context.Context, track *Track, platform int, leaderboardId string, playerId string) ([]Score, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	return s.queryScores(ctx, "SELECT "+scoreColumns+" FROM scores WHERE track = ? AND platform = ? AND leaderboard_id = ? AND player_id = ? ORDER BY rowid",
+		track.Name, platform, leaderboardId, playerId)
+}
+
+// Fetch every region document held by a player on the platform
+func (s *sqliteStore) GetPlayerRegions(ctx context.Context, track *Track, platform int, playerId string) ([]Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	return s.queryPlayers(ctx, "SELECT "+playerColumns+" FROM players WHERE track = ? AND platform = ? AND player_id = ? ORDER BY rowid",
+		track.Name, platform, playerId)
+}
+
+// Fetch every player in a track, grouped by platform and region and ordered by medals
+func (s *sqliteStore) GetTrackStandings(ctx context.Context, track *Track) ([]Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	return s.queryPlayers(ctx, "SELECT "+playerColumns+" FROM players WHERE track = ? ORDER BY platform, region, medals DESC", track.Name)
+}
+
+// Return the rank a player would hold with the provided medals, among the other players in their platform and region
+func (s *sqliteStore) GetMedalRank(ctx context.Context, track *Track, platform int, region string, playerId string, medals int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	var ahead int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM players WHERE track = ? AND platform = ? AND region = ? AND player_id != ? AND medals > ?",
+		track.Name, platform, region, playerId, medals).Scan(&ahead)
+	if err != nil {
+		return 0, err
+	}
+	return ahead + 1, nil
+}
+
+func (s *sqliteStore) GetPlayersWithinMedals(ctx context.Context, track *Track, platform int, region string, lower int, upper int) ([]Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	return s.queryPlayers(ctx, "SELECT "+playerColumns+" FROM players WHERE track = ? AND platform = ? AND region = ? AND medals BETWEEN ? AND ? ORDER BY medals DESC, player_id",
+		track.Name, platform, region, lower, upper)
+}
+
+// Insert a newly tracked score
+func (s *sqliteStore) InsertScore(ctx context.Context, track *Track, score Score) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, "INSERT INTO scores (track, "+scoreColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		track.Name, score.ScoreId, score.PlayerId, score.LeaderboardId, score.Platform, score.Score, score.MaxScore,
+		score.Timestamp, score.Modifiers, score.BadCuts, score.MissedNotes, score.FullCombo, score.MaxCombo)
+	return err
+}
+
+// Delete a score that is no longer tracked
+func (s *sqliteStore) DeleteScore(ctx context.Context, track *Track, platform int, scoreId string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM scores WHERE track = ? AND platform = ? AND score_id = ?", track.Name, platform, scoreId)
+	return err
+}
+
+// Delete a score once no region's standings refer to it
+func (s *sqliteStore) DeleteUntrackedScore(ctx context.Context, track *Track, platform int, scoreId string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, `DELETE FROM scores WHERE track = ? AND platform = ? AND score_id = ?
+		AND NOT EXISTS (SELECT 1 FROM standings WHERE track = scores.track AND platform = scores.platform AND score_id = scores.score_id)`,
+		track.Name, platform, scoreId)
+	return err
+}
+
+// Delete every score a player has stored on the platform
+func (s *sqliteStore) DeletePlayerScores(ctx context.Context, track *Track, platform int, playerId string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, "DELETE FROM scores WHERE track = ? AND platform = ? AND player_id = ?", track.Name, platform, playerId)
+	return err
+}
+
+// Add to the medals and position histograms of players in a region, creating any player who doesn't exist
+//
+// Every delta is applied in a single transaction
+func (s *sqliteStore) ApplyMedalDeltas(ctx context.Context, track *Track, platform int, region string, deltas []MedalDelta) ([]Player, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer transaction.Rollback()
+	players := make([]Player, 0, len(deltas))
+	for _, delta := range deltas {
+		if _, err = transaction.ExecContext(ctx, "INSERT OR IGNORE INTO players (track, platform, region, player_id, username, medals, positions) VALUES (?, ?, ?, ?, '', 0, '{}')",
+			track.Name, platform, region, delta.PlayerId); err != nil {
+			return nil, err
+		}
+		// Increment in place, so concurrent writers can't overwrite each other's medals
+		update := "UPDATE players SET medals = medals + ?"
+		args := []any{delta.Medals}
+		if len(delta.Positions) > 0 {
+			update += ", positions = json_set(positions"
+			for position, count := range delta.Positions {
+				path := `$."` + position + `"`
+				update += ", ?, COALESCE(json_extract(positions, ?), 0) + ?"
+				args = append(args, path, path, count)
+			}
+			update += ")"
+		}
+		if _, err = transaction.ExecContext(ctx, update+" WHERE track = ? AND platform = ? AND region = ? AND player_id = ?",
+			append(args, track.Name, platform, region, delta.PlayerId)...); err != nil {
+			return nil, err
+		}
+		player, err := scanPlayer(transaction.QueryRowContext(ctx, "SELECT "+playerColumns+" FROM players WHERE track = ? AND platform = ? AND region = ? AND player_id = ?",
+			track.Name, platform, region, delta.PlayerId).Scan)
+		if err != nil {
+			return nil, err
+		}
+		players = append(players, player)
+	}
+	if err = transaction.Commit(); err != nil {
+		return nil, err
+	}
+	return players, nil
+}
+
+// Record changes in players' medals
+func (s *sqliteStore) InsertChanges(ctx context.Context, track *Track, changes []Change) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+	for _, change := range changes {
+		if err = insertChange(ctx, transaction, track, change); err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+// Insert a change within a transaction, encoding its achievements and any rollup
+func insertChange(ctx context.Context, transaction *sql.Tx, track *Track, change Change) error {
+	achievements, err := json.Marshal(change.Achievements)
+	if err != nil {
+		return err
+	}
+	rollup := ""
+	if change.Rollup != nil {
+		encoded, err := json.Marshal(change.Rollup)
+		if err != nil {
+			return err
+		}
+		rollup = string(encoded)
+	}
+	_, err = transaction.ExecContext(ctx, "INSERT INTO changes (track, "+changeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		track.Name, change.Platform, change.PlayerId, change.Region, change.Timestamp, change.MedalChange,
+		change.ResponsibleLeaderboardId, change.ResponsiblePlayerId, change.ResponsibleScoreId, change.Reason, string(achievements), rollup)
+	return err
+}
+
+// Call fn with each player matching the filter, stopping at the first error
+func (s *sqliteStore) EachPlayer(ctx context.Context, track *Track, filter ExportFilter, fn func(Player) error) error {
+	from, args := withExportFilter(" FROM players WHERE track = ?", []any{track.Name}, "", filter, true, false)
+	return eachRow(ctx, s, "SELECT "+playerColumns+", rowid"+from, "rowid", args, scanPlayer, fn)
+}
+
+// Call fn with each score matching the filter, stopping at the first error
+func (s *sqliteStore) EachScore(ctx context.Context, track *Track, filter ExportFilter, fn func(Score) error) error {
+	if filter.Region == "" {
+		from, args := withExportFilter(" FROM scores WHERE track = ?", []any{track.Name}, "", filter, false, true)
+		return eachRow(ctx, s, "SELECT "+scoreColumns+", rowid"+from, "rowid", args, scanScoreColumns, fn)
+	}
+	// Scores have no region of their own, so find them through the standings of the region
+	from, args := withExportFilter(` FROM scores JOIN standings ON standings.track = scores.track AND standings.platform = scores.platform
+		AND standings.score_id = scores.score_id WHERE scores.track = ?`, []any{track.Name}, "scores.", filter, false, true)
+	from += " AND standings.region = ?"
+	return eachRow(ctx, s, "SELECT "+qualifiedColumns("scores", scoreColumns)+", scores.rowid"+from, "scores.rowid", append(args, filter.Region), scanScoreColumns, fn)
+}
+
+// Call fn with each change matching the filter, stopping at the first error
+func (s *sqliteStore) EachChange(ctx context.Context, track *Track, filter ExportFilter, fn func(Change) error) error {
+	from, args := withExportFilter(" FROM changes WHERE track = ?", []any{track.Name}, "", filter, true, true)
+	return eachRow(ctx, s, "SELECT "+changeColumns+", rowid"+from, "rowid", args, scanChange, fn)
+}
+
+// Call fn with each standing matching the filter, stopping at the first error
+func (s *sqliteStore) EachStanding(ctx context.Context, track *Track, filter ExportFilter, fn func(Standing) error) error {
+	from, args := withExportFilter(" FROM standings WHERE track = ?", []any{track.Name}, "", filter, true, true)
+	return eachRow(ctx, s, "SELECT "+standingColumns+", rowid"+from, "rowid", args, scanStanding, fn)
+}
+
+// Store players, replacing any already stored in the same platform and region
+func (s *sqliteStore) UpsertPlayers(ctx context.Context, track *Track, players []Player) error {
+	return upsertRows(ctx, s, players, func(ctx context.Context, transaction *sql.Tx, player Player) error {
+		positions, err := json.Marshal(player.Positions)
+		if err != nil {
+			return err
+		}
+		// Histories are appended to in place, so they must be arrays rather than null
+		if player.UsernameHistory == nil {
+			player.UsernameHistory = []UsernameRecord{}
+		}
+		if player.CountryHistory == nil {
+			player.CountryHistory = []CountryRecord{}
+		}
+		usernameHistory, err := json.Marshal(player.UsernameHistory)
+		if err != nil {
+			return err
+		}
+		countryHistory, err := json.Marshal(player.CountryHistory)
+		if err != nil {
+			return err
+		}
+		_, err = transaction.ExecContext(ctx, "INSERT OR REPLACE INTO players (track, "+playerColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			track.Name, player.PlayerId, player.Platform, player.Region, player.Medals, player.Username, string(positions),
+			player.Avatar, player.Country, player.PP, player.Rank, player.Role, player.Clan, string(usernameHistory), string(countryHistory))
+		return err
+	})
+}
+
+// Store scores, replacing any already stored with the same id
+func (s *sqliteStore) UpsertScores(ctx context.Context, track *Track, scores []Score) error {
+	return upsertRows(ctx, s, scores, func(ctx context.Context, transaction *sql.Tx, score Score) error {
+		_, err := transaction.ExecContext(ctx, "INSERT OR REPLACE INTO scores (track, "+scoreColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			track.Name, score.ScoreId, score.PlayerId, score.LeaderboardId, score.Platform, score.Score, score.MaxScore,
+			score.Timestamp, score.Modifiers, score.BadCuts, score.MissedNotes, score.FullCombo, score.MaxCombo)
+		return err
+	})
+}
+
+// Store changes, replacing any already recorded for the same player, cause and time
+func (s *sqliteStore) UpsertChanges(ctx context.Context, track *Track, changes []Change) error {
+	return upsertRows(ctx, s, changes, func(ctx context.Context, transaction *sql.Tx, change Change) error {
+		if _, err := transaction.ExecContext(ctx, `DELETE FROM changes WHERE track = ? AND platform = ? AND region = ? AND player_id = ?
+			AND timestamp = ? AND responsible_score_id = ? AND reason = ?`,
+			track.Name, change.Platform, change.Region, change.PlayerId, change.Timestamp, change.ResponsibleScoreId, change.Reason); err != nil {
+			return err
+		}
+		return insertChange(ctx, transaction, track, change)
+	})
+}
+
+// Store standings, replacing any already stored for the same player on the leaderboard and region
+func (s *sqliteStore) UpsertStandings(ctx context.Context, track *Track, standings []Standing) error {
+	return upsertRows(ctx, s, standings, func(ctx context.Context, transaction *sql.Tx, standing Standing) error {
+		_, err := transaction.ExecContext(ctx, "INSERT OR REPLACE INTO standings (track, "+standingColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			track.Name, standing.Platform, standing.LeaderboardId, standing.Region, standing.Position,
+			standing.ScoreId, standing.PlayerId, standing.Score, standing.Timestamp)
+		return err
+	})
+}
+
+// Return whether any changes have been rolled up
+func (s *sqliteStore) HasRollups(ctx context.Context, track *Track) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM changes WHERE track = ? AND reason = ?)", track.Name, ChangeReasonRollup).Scan(&exists)
+	return exists, err
+}
+
+// Return the timestamp of the oldest raw change recorded from after up to (not including) before, or false if there are none
+func (s *sqliteStore) GetOldestChangeTimestamp(ctx context.Context, track *Track, after int64, before int64) (int64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	var oldest sql.NullInt64
+	err := s.db.QueryRowContext(ctx, "SELECT MIN(timestamp) FROM changes WHERE track = ? AND timestamp >= ? AND timestamp < ? AND reason != ?",
+		track.Name, after, before, ChangeReasonRollup).Scan(&oldest)
+	return oldest.Int64, oldest.Valid, err
+}
+
+func (s *sqliteStore) EachChangeWithId(ctx context.Context, track *Track, from int64, to int64, fn func(string, Change) error) error {
+	// The row id is selected twice, once for the change and once for paging
+	return eachRow(ctx, s, "SELECT "+changeColumns+", rowid, rowid FROM changes WHERE track = ? AND timestamp >= ? AND timestamp < ?", "rowid",
+		[]any{track.Name, from, to}, func(scan func(...any) error) (sqliteChange, error) {
+			var id int64
+			change, err := scanChange(func(columns ...any) error {
+				return scan(append(columns, &id)...)
+			})
+			return sqliteChange{id, change}, err
+		}, func(change sqliteChange) error {
+			return fn(strconv.FormatInt(change.id, 10), change.change)
+		})
+}
+
+// A change along with its row id
+type sqliteChange struct {
+	id     int64
+	change Change
+}
+
+// Replace the rollups of the days from from up to (not including) to, and delete the raw changes folded into them
+//
+// Everything is written in one transaction, so the rollups don't need to remember the changes they hold
+func (s *sqliteStore) CompactChanges(ctx context.Context, track *Track, from int64, to int64, rollups []Change, folded []string) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+	if _, err = transaction.ExecContext(ctx, "DELETE FROM changes WHERE track = ? AND timestamp >= ? AND timestamp < ? AND reason = ?",
+		track.Name, from, to, ChangeReasonRollup); err != nil {
+		return err
+	}
+	for _, id := range folded {
+		if _, err = transaction.ExecContext(ctx, "DELETE FROM changes WHERE track = ? AND rowid = ?", track.Name, id); err != nil {
+			return err
+		}
+	}
+	for _, rollup := range rollups {
+		if err = insertChange(ctx, transaction, track, rollup); err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+// Refresh a player's profile in every region of the track, recording any new username or country
+//
+// Every column is set from the row as it was before the update, so the history is decided against the
+// stored profile within the same statement
+func (s *sqliteStore) UpdatePlayerProfile(ctx context.Context, track *Track, platform int, playerId string, profile PlayerProfile) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	// A nil clan leaves the stored clan alone
+	var clan any
+	if profile.Clan != nil {
+		clan = *profile.Clan
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE players SET
+		username_history = CASE WHEN username != ?1 OR json_array_length(username_history) = 0
+			THEN json_insert(username_history, '$[#]', json_object('Username', ?1, 'Timestamp', ?2)) ELSE username_history END,
+		country_history = CASE WHEN ?3 != '' AND (country != ?3 OR json_array_length(country_history) = 0)
+			THEN json_insert(country_history, '$[#]', json_object('Country', ?3, 'Timestamp', ?2)) ELSE country_history END,
+		username = ?1,
+		avatar = COALESCE(NULLIF(?4, ''), avatar),
+		country = COALESCE(NULLIF(?3, ''), country),
+		pp = CASE WHEN ?5 > 0 THEN ?5 ELSE pp END,
+		rank = CASE WHEN ?6 > 0 THEN ?6 ELSE rank END,
+		role = COALESCE(NULLIF(?7, ''), role),
+		clan = COALESCE(?8, clan)
+		WHERE track = ?9 AND platform = ?10 AND player_id = ?11`,
+		profile.Username, profile.Timestamp, profile.Country, profile.Avatar, profile.PP, profile.Rank, profile.Role, clan,
+		track.Name, platform, playerId)
+	return err
+}
+
+// Total the snipes between every pair of players from the changes ledger
+func (s *sqliteStore) GetSnipeTotals(ctx context.Context, track *Track) ([]Rivalry, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.migration)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, `SELECT platform, region, player_id, responsible_player_id, COUNT(*), SUM(-medal_change) FROM changes
+		WHERE track = ? AND reason IN ('score', '') AND medal_change < 0 AND player_id != responsible_player_id
+		GROUP BY platform, region, player_id, responsible_player_id`, track.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rivalries := []Rivalry{}
+	for rows.Next() {
+		var rivalry Rivalry
+		if err = rows.Scan(&rivalry.Platform, &rivalry.Region, &rivalry.PlayerId, &rivalry.SniperId, &rivalry.Snipes, &rivalry.MedalsLost); err != nil {
+			return nil, err
+		}
+		rivalries = append(rivalries, rivalry)
+	}
+	return rivalries, rows.Err()
+}
+
+// Return whether the player lost medals on a leaderboard to another player before the timestamp
+func (s *sqliteStore) WasSniped(ctx context.Context, track *Track, platform int, region string, playerId string, leaderboardId string, before int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	var sniped bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM changes WHERE track = ? AND platform = ? AND region = ? AND player_id = ?
+		AND responsible_leaderboard_id = ? AND responsible_player_id != ? AND medal_change < 0 AND timestamp <= ?)`,
+		track.Name, platform, region, playerId, leaderboardId, playerId, before).Scan(&sniped)
+	return sniped, err
+}
+
+// Fetch every change where the player gained medals from their own score, oldest first
+func (s *sqliteStore) GetPlayerGains(ctx context.Context, track *Track, platform int, region string, playerId string) ([]Change, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	return s.queryChanges(ctx, "SELECT "+changeColumns+` FROM changes WHERE track = ? AND platform = ? AND region = ? AND player_id = ?
+		AND responsible_player_id = ? AND medal_change > 0 ORDER BY timestamp, id`,
+		track.Name, platform, region, playerId, playerId)
+}
+
+// Fetch a page of the clans ordered by the combined medals of their members in a region
+func (s *sqliteStore) GetClanStandings(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[ClanStanding], error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.aggregate)
+	defer cancel()
+	sort := clanMedalSort
+	// Rank by number of first places, using medals to break ties
+	if sortBy == SortByFirsts {
+		sort = clanFirstsSort
+	}
+	cursor, err := decodeCursor(request.Cursor, sort)
+	if err != nil {
+		return Page[ClanStanding]{}, err
+	}
+	// The clans are only totalled once grouped, so the cursor is matched against the totals
+	from := " FROM (" + clanTotals + " AND clan != '' GROUP BY clan) WHERE members > 0"
+	args := []any{track.Name, platform, region}
+	total, err := s.countTotal(ctx, from, args, request)
+	if err != nil {
+		return Page[ClanStanding]{}, err
+	}
+	from, args = withKeyset(from, args, sort, cursor)
+	standings, err := s.queryClanStandings(ctx, "SELECT clan, medals, firsts, members"+from+orderFor(sort, cursor)+" LIMIT ?", append(args, request.limit()+1)...)
+	if err != nil {
+		return Page[ClanStanding]{}, err
+	}
+	page := buildPage(standings, request, cursor, func(standing ClanStanding) []any {
+		if sortBy == SortByFirsts {
+			return []any{int64(standing.Firsts), int64(standing.Medals), standing.Clan}
+		}
+		return []any{int64(standing.Medals), standing.Clan}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Fetch the combined standing of a single clan in a region
+func (s *sqliteStore) GetClanStanding(ctx context.Context, track *Track, platform int, region string, clan string) (ClanStanding, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.aggregate)
+	defer cancel()
+	standings, err := s.queryClanStandings(ctx, clanTotals+" AND clan = ? GROUP BY clan", track.Name, platform, region, clan)
+	if err != nil || len(standings) == 0 {
+		return ClanStanding{Clan: clan}, err
+	}
+	return standings[0], nil
+}
+
+// Fetch a page of the members of a clan holding medals in a region, ordered by medals
+func (s *sqliteStore) GetClanMembers(ctx context.Context, track *Track, platform int, region string, clan string, request PageRequest) (Page[Player], error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	cursor, err := decodeCursor(request.Cursor, medalHolderSort)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	from := " FROM players WHERE track = ? AND platform = ? AND region = ? AND clan = ?"
+	args := []any{track.Name, platform, region, clan}
+	total, err := s.countTotal(ctx, from, args, request)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	from, args = withKeyset(from, args, medalHolderSort, cursor)
+	players, err := s.queryPlayers(ctx, "SELECT "+playerColumns+from+orderFor(medalHolderSort, cursor)+" LIMIT ?", append(args, request.limit()+1)...)
+	if err != nil {
+		return Page[Player]{}, err
+	}
+	page := buildPage(players, request, cursor, func(player Player) []any {
+		return []any{int64(player.Medals), player.PlayerId}
+	})
+	page.Total = total
+	return page, nil
+}
+
+// Return the clan each of the players is in, players without a clan are left out
+func (s *sqliteStore) GetPlayerClans(ctx context.Context, track *Track, platform int, playerIds []string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	clans := make(map[string]string, len(playerIds))
+	if len(playerIds) == 0 {
+		return clans, nil
+	}
+	args := []any{track.Name, platform}
+	for _, playerId := range playerIds {
+		args = append(args, playerId)
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT player_id, clan FROM players WHERE track = ? AND platform = ? AND clan != '' AND player_id IN (?"+
+		strings.Repeat(", ?", len(playerIds)-1)+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var playerId, clan string
+		if err = rows.Scan(&playerId, &clan); err != nil {
+			return nil, err
+		}
+		clans[playerId] = clan
+	}
+	return clans, rows.Err()
+}
+
+// Add the before and after filters on the provided column to a query
+func withTimestampRange(query string, args []any, column string, before int64, after int64) (string, []any) {
+	if before != 0 {
+		query += " AND " + column + " <= ?"
+		args = append(args, before)
+	}
+	if after != 0 {
+		query += " AND " + column + " >= ?"
+		args = append(args, after)
+	}
+	return query, args
+}
+
+// Add the platform, region and timestamp conditions of an export filter to a query
+//
+// The prefix qualifies the columns, such as "scores." when the query joins another table
+func withExportFilter(query string, args []any, prefix string, filter ExportFilter, withRegion bool, withTimestamp bool) (string, []any) {
+	if filter.Platform != 0 {
+		query += " AND " + prefix + "platform = ?"
+		args = append(args, filter.Platform)
+	}
+	if withRegion && filter.Region != "" {
+		query += " AND " + prefix + "region = ?"
+		args = append(args, filter.Region)
+	}
+	if withTimestamp {
+		query, args = withTimestampRange(query, args, prefix+"timestamp", filter.Before, filter.After)
+	}
+	return query, args
+}
+
+// Qualify each of a list of columns with its table
+func qualifiedColumns(table string, columns string) string {
+	qualified := strings.Split(columns, ", ")
+	for i, column := range qualified {
+		qualified[i] = table + "." + column
+	}
+	return strings.Join(qualified, ", ")
+}
+
+// Call fn with each row of a query in turn, stopping at the first error
+//
+// The query must select the row id last. Rows are read in batches by row id, so the shared connection
+// isn't held while fn runs, such as while an export is written to a slow client.
+func eachRow[T any](ctx context.Context, s *sqliteStore, query string, rowid string, args []any, scan func(func(...any) error) (T, error), fn func(T) error) error {
+	var after int64
+	for {
+		batch, last, err := rowBatch(ctx, s, query+" AND "+rowid+" > ? ORDER BY "+rowid+" LIMIT ?", append(args, after, transferBatchSize), scan)
+		if err != nil {
+			return err
+		}
+		for _, item := range batch {
+			if err = fn(item); err != nil {
+				return err
+			}
+		}
+		if len(batch) < transferBatchSize {
+			return nil
+		}
+		after = last
+	}
+}
+
+// Read a batch of rows selecting their row id last, returning the last row id read
+func rowBatch[T any](ctx context.Context, s *sqliteStore, query string, args []any, scan func(func(...any) error) (T, error)) ([]T, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.read)
+	defer cancel()
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var batch []T
+	var rowid int64
+	for rows.Next() {
+		item, err := scan(func(columns ...any) error {
+			return rows.Scan(append(columns, &rowid)...)
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		batch = append(batch, item)
+	}
+	return batch, rowid, rows.Err()
+}
+
+// Write items in transactions of a batch each, stopping at the first error
+func upsertRows[T any](ctx context.Context, s *sqliteStore, items []T, write func(context.Context, *sql.Tx, T) error) error {
+	for start := 0; start < len(items); start += transferBatchSize {
+		if err := upsertBatch(ctx, s, items[start:min(start+transferBatchSize, len(items))], write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertBatch[T any](ctx context.Context, s *sqliteStore, batch []T, write func(context.Context, *sql.Tx, T) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeouts.write)
+	defer cancel()
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+	for _, item := range batch {
+		if err = write(ctx, transaction, item); err != nil {
+			return err
+		}
+	}
+	return transaction.Commit()
+}
+
+// Add the conditions matching every row past the cursor to a query, in the direction of the cursor
+func withKeyset(query string, args []any, keys []sortKey, cursor pageCursor) (string, []any) {
+	if cursor.Values == nil {
+		return query, args
+	}
+	// Match rows past the cursor on the first key, or equal to it and past it on a later key
+	alternatives := make([]string, 0, len(keys))
+	for i, key := range keys {
+		conditions := make([]string, 0, i+1)
+		for j := range i {
+			conditions = append(conditions, keys[j].column+" = ?")
+			args = append(args, cursor.Values[j])
+		}
+		operator := " > ?"
+		if key.descending != cursor.Backward {
+			operator = " < ?"
+		}
+		conditions = append(conditions, key.column+operator)
+		args = append(args, cursor.Values[i])
+		alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+	}
+	return query + " AND (" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// Return the order to fetch rows in, reversed when paging backward
+func orderFor(keys []sortKey, cursor pageCursor) string {
+	order := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.descending != cursor.Backward {
+			order = append(order, key.column+" DESC")
+		} else {
+			order = append(order, key.column)
+		}
+	}
+	return " ORDER BY " + strings.Join(order, ", ")
+}
+
+// Count the rows across all pages if the request asks for a total
+func (s *sqliteStore) countTotal(ctx context.Context, from string, args []any, request PageRequest) (*int64, error) {
+	if !request.IncludeTotal {
+		return nil, nil
+	}
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+from, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+	return &total, nil
+}
+
+func (s *sqliteStore) queryScores(ctx context.Context, query string, args ...any) ([]Score, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []Score{}, err
+	}
+	defer rows.Close()
+	scores := []Score{}
+	for rows.Next() {
+		score, err := scanScore(rows)
+		if err != nil {
+			return []Score{}, err
+		}
+		scores = append(scores, score)
+	}
+	return scores, rows.Err()
+}
+
+func (s *sqliteStore) queryPlayers(ctx context.Context, query string, args ...any) ([]Player, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []Player{}, err
+	}
+	defer rows.Close()
+	players := []Player{}
+	for rows.Next() {
+		player, err := scanPlayer(rows.Scan)
+		if err != nil {
+			return []Player{}, err
+		}
+		players = append(players, player)
+	}
+	return players, rows.Err()
+}
+
+func (s *sqliteStore) queryChanges(ctx context.Context, query string, args ...any) ([]Change, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []Change{}, err
+	}
+	defer rows.Close()
+	changes := []Change{}
+	for rows.Next() {
+		change, err := scanChange(rows.Scan)
+		if err != nil {
+			return []Change{}, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// Query clan standings, selecting the clan, medals, first places and members in that order
+func (s *sqliteStore) queryClanStandings(ctx context.Context, query string, args ...any) ([]ClanStanding, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return []ClanStanding{}, err
+	}
+	defer rows.Close()
+	standings := []ClanStanding{}
+	for rows.Next() {
+		var standing ClanStanding
+		if err = rows.Scan(&standing.Clan, &standing.Medals, &standing.Firsts, &standing.Members); err != nil {
+			return []ClanStanding{}, err
+		}
+		standings = append(standings, standing)
+	}
+	return standings, rows.Err()
+}
+
+// Scan a score from either a single row or a set of rows
+func scanScore(row interface{ Scan(...any) error }) (Score, error) {
+	return scanScoreColumns(row.Scan)
+}
+
+// Scan a score using the provided scan function, such as one that also scans a row id
+func scanScoreColumns(scan func(...any) error) (Score, error) {
+	var score Score
+	err := scan(&score.ScoreId, &score.PlayerId, &score.LeaderboardId, &score.Platform, &score.Score, &score.MaxScore,
+		&score.Timestamp, &score.Modifiers, &score.BadCuts, &score.MissedNotes, &score.FullCombo, &score.MaxCombo)
+	return score, err
+}
+
+// Scan a standing using the provided scan function
+func scanStanding(scan func(...any) error) (Standing, error) {
+	var standing Standing
+	err := scan(&standing.Platform, &standing.LeaderboardId, &standing.Region, &standing.Position,
+		&standing.ScoreId, &standing.PlayerId, &standing.Score, &standing.Timestamp)
+	return standing, err
+}
+
+// Scan a player using the provided scan function, decoding their position histogram and profile history
+func scanPlayer(scan func(...any) error) (Player, error) {
+	var player Player
+	var positions, usernameHistory, countryHistory string
+	if err := scan(&player.PlayerId, &player.Platform, &player.Region, &player.Medals, &player.Username, &positions,
+		&player.Avatar, &player.Country, &player.PP, &player.Rank, &player.Role, &player.Clan, &usernameHistory, &countryHistory); err != nil {
+		return Player{}, err
+	}
+	if err := json.Unmarshal([]byte(positions), &player.Positions); err != nil {
+		return Player{}, err
+	}
+	if err := json.Unmarshal([]byte(usernameHistory), &player.UsernameHistory); err != nil {
+		return Player{}, err
+	}
+	err := json.Unmarshal([]byte(countryHistory), &player.CountryHistory)
+	return player, err
+}
+
+// Scan a change using the provided scan function, decoding its achievements and any rollup
+func scanChange(scan func(...any) error) (Change, error) {
+	var change Change
+	var achievements, rollup string
+	if err := scan(&change.Platform, &change.PlayerId, &change.Region, &change.Timestamp, &change.MedalChange,
+		&change.ResponsibleLeaderboardId, &change.ResponsiblePlayerId, &change.ResponsibleScoreId, &change.Reason, &achievements, &rollup); err != nil {
+		return Change{}, err
+	}
+	if err := json.Unmarshal([]byte(achievements), &change.Achievements); err != nil {
+		return Change{}, err
+	}
+	if rollup != "" {
+		change.Rollup = &ChangeRollup{}
+		if err := json.Unmarshal([]byte(rollup), change.Rollup); err != nil {
+			return Change{}, err
+		}
+	}
+	return change, nil
+}
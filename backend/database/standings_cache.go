@@ -0,0 +1,168 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"nonetaken.dev/medalsaber/config"
+)
+
+// The leaderboard and region a cached list of standings belongs to
+type standingsKey struct {
+	track         string
+	platform      int
+	leaderboardId string
+	region        string
+}
+
+// The cached standings of a leaderboard in a region, best first
+type standingsEntry struct {
+	key       standingsKey
+	standings []Standing
+	// Whether the standings hold every stored position, rather than just the top of a longer list
+	complete bool
+}
+
+// A bounded cache of the standings of recently scored leaderboards, dropping the least recently used first
+//
+// The engine writes through the cache whenever it replaces standings, so most scores that don't
+// place can be turned away without touching the database
+type standingsCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[standingsKey]*list.Element
+	// The entries from most to least recently used
+	order  *list.List
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// How well the standings cache is serving lookups
+type StandingsCacheStats struct {
+	Hits     int64
+	Misses   int64
+	Entries  int
+	Capacity int
+}
+
+// The cache in use, holding STANDINGS_CACHE_SIZE leaderboard regions, disabled by default
+//
+// Each process keeps its own cache and only sees the standings it writes itself, so it must only be
+// enabled when a single process ingests scores. Any other ingester would leave it serving stale standings.
+var cache = newStandingsCache(0)
+
+func newStandingsCache(capacity int) *standingsCache {
+	return &standingsCache{
+		capacity: capacity,
+		entries:  make(map[standingsKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Return the cached standings holding at least the provided number of positions, or false if there are none
+func (c *standingsCache) get(key standingsKey, limit int64) ([]Standing, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*standingsEntry)
+	if !entry.complete && int64(len(entry.standings)) < limit {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	// Hand out a copy, callers insert into the standings they're given
+	return slices.Clone(entry.standings[:min(int64(len(entry.standings)), limit)]), true
+}
+
+// Cache the standings of a leaderboard region, replacing any already cached
+func (c *standingsCache) set(key standingsKey, standings []Standing, complete bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.store(key, standings, complete)
+}
+
+// Cache standings read from the store, unless they've been cached since
+//
+// The engine may have replaced the standings while they were being read, so they should never
+// overwrite what it wrote
+func (c *standingsCache) fill(key standingsKey, standings []Standing, complete bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.store(key, standings, complete)
+}
+
+func (c *standingsCache) store(key standingsKey, standings []Standing, complete bool) {
+	if c.capacity <= 0 {
+		return
+	}
+	entry := &standingsEntry{key: key, standings: slices.Clone(standings), complete: complete}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	// Make room by dropping the least recently used standings
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*standingsEntry).key)
+	}
+}
+
+// Drop the cached standings of a leaderboard region, such as when they failed to save
+func (c *standingsCache) remove(key standingsKey) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Create the standings cache and fill it with the most recently scored leaderboards of the lifetime track
+func initialiseCache(ctx context.Context) {
+	cache = newStandingsCache(config.GetInt("STANDINGS_CACHE_SIZE", 0))
+	if cache.capacity <= 0 {
+		return
+	}
+	standings, err := store.GetRecentStandings(ctx, Lifetime, cache.capacity)
+	if err != nil {
+		log.Printf("error when warming the standings cache: %s\n", err)
+		return
+	}
+	// The standings are grouped by leaderboard region, each group holding every stored position
+	warmed := 0
+	for start := 0; start < len(standings); {
+		key := standingsKey{Lifetime.Name, standings[start].Platform, standings[start].LeaderboardId, standings[start].Region}
+		end := start + 1
+		for end < len(standings) && (standingsKey{Lifetime.Name, standings[end].Platform, standings[end].LeaderboardId, standings[end].Region}) == key {
+			end++
+		}
+		cache.fill(key, standings[start:end], true)
+		warmed++
+		start = end
+	}
+	log.Printf("warmed the standings cache with %d leaderboard regions", warmed)
+}
+
+// Return how well the standings cache is serving lookups
+func GetStandingsCacheStats() StandingsCacheStats {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return StandingsCacheStats{
+		Hits:     cache.hits.Load(),
+		Misses:   cache.misses.Load(),
+		Entries:  cache.order.Len(),
+		Capacity: cache.capacity,
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// The medal value of each (indexed) position in the leaderboard
+var MedalValues = map[int]int{
+	0: 10,
+	1: 8,
+	2: 6,
+	3: 5,
+	4: 4,
+	5: 3,
+	6: 2,
+	7: 1,
+	8: 1,
+	9: 1,
+	// We need to specify the 11th position score because scores pushed out of the top 10
+	// will need to know how many medals position 11 is worth, which is 0!
+	10: 0,
+}
+
+// The number of positions on each leaderboard that pay out medals
+const MedalPositions = 10
+
+// The number of reserve positions, read from RESERVE_POSITIONS when the database is initialised
+var reservePositions = 10
+
+// The number of scores tracked below the medal positions for each leaderboard and region
+//
+// These reserve scores don't earn medals, but allow the next best score to be promoted
+// into the top 10 when a score is removed. Configured with RESERVE_POSITIONS.
+func ReservePositions() int {
+	return reservePositions
+}
+
+// The total number of positions tracked for each leaderboard and region
+func TrackedPositions() int {
+	return MedalPositions + ReservePositions()
+}
+
+// Rank players by medals within each platform and region, players with equal medals share a rank
+//
+// The players must be grouped and ordered as returned by GetTrackStandings
+func RankStandings(players []Player) []int {
+	ranks := make([]int, len(players))
+	groupStart := 0
+	for i, player := range players {
+		// Restart the ranking for each platform and region
+		if i == 0 || player.Platform != players[i-1].Platform || player.Region != players[i-1].Region {
+			groupStart = i
+			ranks[i] = 1
+			continue
+		}
+		if player.Medals == players[i-1].Medals {
+			ranks[i] = ranks[i-1]
+			continue
+		}
+		ranks[i] = i - groupStart + 1
+	}
+	return ranks
+}
+
+// Fill in the medal rank of each player
+func FillMedalRanks(ctx context.Context, track *Track, players []Player) error {
+	for i := range players {
+		// Players with the same medals as the previous player share their rank
+		if i > 0 && players[i].Platform == players[i-1].Platform && players[i].Region == players[i-1].Region && players[i].Medals == players[i-1].Medals {
+			players[i].MedalRank = players[i-1].MedalRank
+			continue
+		}
+		rank, err := GetMedalRank(ctx, track, players[i].Platform, players[i].Region, players[i].PlayerId, players[i].Medals)
+		if err != nil {
+			return err
+		}
+		players[i].MedalRank = rank
+	}
+	return nil
+}
+
+// Fetch a page of a player's rank changes in a region, newest first
+func GetRankChanges(ctx context.Context, platform int, region string, playerId string, request PageRequest) (Page[RankChange], error) {
+	return fetchPage(ctx, Collections.RankChanges, bson.M{
+		"platform": platform,
+		"region":   region,
+		"playerId": playerId,
+	}, request, rankChangeSort, func(rankChange RankChange) []any {
+		return []any{rankChange.Timestamp, rankChange.ResponsibleLeaderboardId}
+	})
+}
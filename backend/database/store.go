@@ -0,0 +1,311 @@
+package database
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// The storage backends the standings can be kept in, chosen with DATABASE_BACKEND
+const (
+	MongoBackend  = "mongo"
+	SqliteBackend = "sqlite"
+)
+
+// Returned when a requested score or player doesn't exist, whichever backend is in use
+var ErrNotFound = mongo.ErrNoDocuments
+
+// The operations the medal engine performs on a track's scores, players and changes
+//
+// Every backend must behave identically, the checks in store_test.go run against each of them
+type Store interface {
+	GetScore(ctx context.Context, track *Track, platform int, scoreId string) (Score, error)
+	GetPlayerScores(ctx context.Context, track *Track, player *Player, request PageRequest, before int64, after int64) (Page[Score], error)
+	GetChanges(ctx context.Context, track *Track, platform int, region string, playerId string, request PageRequest, before int64, after int64) (Page[Change], error)
+	IsWithinTopTen(ctx context.Context, track *Track, platform int, leaderboardId string, region string, score int, depth int) (bool, error)
+	GetStandings(ctx context.Context, track *Track, platform int, region string, leaderboardId string, limit int64) ([]Standing, error)
+	SetStandings(ctx context.Context, track *Track, platform int, leaderboardId string, region string, standings []Standing) error
+	GetRecentStandings(ctx context.Context, track *Track, limit int) ([]Standing, error)
+	GetPlayerStandings(ctx context.Context, track *Track, platform int, playerId string) ([]Standing, error)
+	GetTopTenMedalHolders(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[Player], error)
+	GetPlayer(ctx context.Context, track *Track, platform int, region string, playerId string, username string, createIfAbsent bool) (*Player, error)
+	GetAllPlayerScores(ctx context.Context, track *Track, platform int, playerId string) ([]Score, error)
+	GetLeaderboardScores(ctx context.Context, track *Track, platform int, leaderboardId string, playerId string) ([]Score, error)
+	GetPlayerRegions(ctx context.Context, track *Track, platform int, playerId string) ([]Player, error)
+	GetTrackStandings(ctx context.Context, track *Track) ([]Player, error)
+	GetMedalRank(ctx context.Context, track *Track, platform int, region string, playerId string, medals int) (int, error)
+	GetPlayersWithinMedals(ctx context.Context, track *Track, platform int, region string, lower int, upper int) ([]Player, error)
+	InsertScore(ctx context.Context, track *Track, score Score) error
+	DeleteScore(ctx context.Context, track *Track, platform int, scoreId string) error
+	DeleteUntrackedScore(ctx context.Context, track *Track, platform int, scoreId string) error
+	DeletePlayerScores(ctx context.Context, track *Track, platform int, playerId string) error
+	ApplyMedalDeltas(ctx context.Context, track *Track, platform int, region string, deltas []MedalDelta) ([]Player, error)
+	InsertChanges(ctx context.Context, track *Track, changes []Change) error
+	EachPlayer(ctx context.Context, track *Track, filter ExportFilter, fn func(Player) error) error
+	EachScore(ctx context.Context, track *Track, filter ExportFilter, fn func(Score) error) error
+	EachChange(ctx context.Context, track *Track, filter ExportFilter, fn func(Change) error) error
+	EachStanding(ctx context.Context, track *Track, filter ExportFilter, fn func(Standing) error) error
+	UpsertPlayers(ctx context.Context, track *Track, players []Player) error
+	UpsertScores(ctx context.Context, track *Track, scores []Score) error
+	UpsertChanges(ctx context.Context, track *Track, changes []Change) error
+	UpsertStandings(ctx context.Context, track *Track, standings []Standing) error
+	GetOldestChangeTimestamp(ctx context.Context, track *Track, after int64, before int64) (int64, bool, error)
+	HasRollups(ctx context.Context, track *Track) (bool, error)
+	EachChangeWithId(ctx context.Context, track *Track, from int64, to int64, fn func(string, Change) error) error
+	CompactChanges(ctx context.Context, track *Track, from int64, to int64, rollups []Change, folded []string) error
+	UpdatePlayerProfile(ctx context.Context, track *Track, platform int, playerId string, profile PlayerProfile) error
+	GetSnipeTotals(ctx context.Context, track *Track) ([]Rivalry, error)
+	WasSniped(ctx context.Context, track *Track, platform int, region string, playerId string, leaderboardId string, before int64) (bool, error)
+	GetPlayerGains(ctx context.Context, track *Track, platform int, region string, playerId string) ([]Change, error)
+	GetClanStandings(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[ClanStanding], error)
+	GetClanStanding(ctx context.Context, track *Track, platform int, region string, clan string) (ClanStanding, error)
+	GetClanMembers(ctx context.Context, track *Track, platform int, region string, clan string, request PageRequest) (Page[Player], error)
+	GetPlayerClans(ctx context.Context, track *Track, platform int, playerIds []string) (map[string]string, error)
+}
+
+// A change to a player's medals and position histogram, keyed by position ("1" for first place)
+type MedalDelta struct {
+	PlayerId  string
+	Medals    int
+	Positions map[string]int
+}
+
+// The profile details sent with a score, empty fields leave the stored details alone
+type PlayerProfile struct {
+	Username string
+	Avatar   string
+	Country  string
+	PP       float64
+	Rank     int
+	Role     string
+	// Only BeatLeader has clans, nil leaves the stored clan alone while "" means the player left it
+	Clan *string
+	// When the details were sent, recorded with any username or country that changed
+	Timestamp int64
+}
+
+// The store the standings are kept in
+var store Store = mongoStore{}
+
+// Open the store chosen with DATABASE_BACKEND, MongoDB by default
+//
+// The SQLite backend keeps the standings, players and changes in the file at SQLITE_PATH. Everything
+// else, such as bans, seasons and achievements, is kept in MongoDB if MONGO_URI is set and disabled
+// otherwise
+func initialiseStore(ctx context.Context) {
+	backend := os.Getenv("DATABASE_BACKEND")
+	switch backend {
+	case "", MongoBackend:
+		store = mongoStore{}
+	case SqliteBackend:
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "medalsaber.db"
+		}
+		sqlite, err := openSqliteStore(ctx, path)
+		if err != nil {
+			log.Fatalf("error when opening SQLite database %s: %s\n", path, err)
+		}
+		store = sqlite
+	default:
+		log.Fatalf("unknown DATABASE_BACKEND %q, use %s or %s\n", backend, MongoBackend, SqliteBackend)
+	}
+}
+
+// Fetch a score from the database
+func GetScore(ctx context.Context, track *Track, platform int, scoreId string) (Score, error) {
+	return store.GetScore(ctx, track, platform, scoreId)
+}
+
+// Fetch a page of a player's scores from the database, newest first
+func GetPlayerScores(ctx context.Context, track *Track, player *Player, request PageRequest, before int64, after int64) (Page[Score], error) {
+	return store.GetPlayerScores(ctx, track, player, request, before, after)
+}
+
+// Fetch a page of a player's changes from the database, in the order they were recorded
+func GetChanges(ctx context.Context, track *Track, platform int, region string, playerId string, request PageRequest, before int64, after int64) (Page[Change], error) {
+	return store.GetChanges(ctx, track, platform, region, playerId, request, before, after)
+}
+
+// Return whether the provided score is within the top scores tracked for that leaderboard
+//
+// The check is answered from the standings cache where possible, caching the standings otherwise
+func IsWithinTopTen(ctx context.Context, track *Track, platform int, leaderboardId string, region string, score int, depth int) (bool, error) {
+	if cache.capacity <= 0 {
+		return store.IsWithinTopTen(ctx, track, platform, leaderboardId, region, score, depth)
+	}
+	standings, err := GetStandings(ctx, track, platform, region, leaderboardId, int64(depth))
+	if err != nil {
+		return false, err
+	}
+	// The leaderboard isn't full, so any score is within it
+	if len(standings) < depth {
+		return true, nil
+	}
+	return score > standings[depth-1].Score, nil
+}
+
+// Get the standings of a leaderboard in a region, best first, up to the provided limit
+func GetStandings(ctx context.Context, track *Track, platform int, region string, leaderboardId string, limit int64) ([]Standing, error) {
+	key := standingsKey{track.Name, platform, leaderboardId, region}
+	if standings, ok := cache.get(key, limit); ok {
+		cache.hits.Add(1)
+		return standings, nil
+	}
+	cache.misses.Add(1)
+	standings, err := store.GetStandings(ctx, track, platform, region, leaderboardId, limit)
+	if err != nil {
+		return standings, err
+	}
+	// Fewer standings than the limit means we have every stored position
+	cache.fill(key, standings, int64(len(standings)) < limit)
+	return standings, nil
+}
+
+// Replace the standings of a leaderboard in a region, the standings should be numbered from 1 in order
+func SetStandings(ctx context.Context, track *Track, platform int, leaderboardId string, region string, standings []Standing) error {
+	key := standingsKey{track.Name, platform, leaderboardId, region}
+	if err := store.SetStandings(ctx, track, platform, leaderboardId, region, standings); err != nil {
+		// The standings may have been partly replaced, so read them afresh next time
+		cache.remove(key)
+		return err
+	}
+	cache.set(key, standings, true)
+	return nil
+}
+
+// Fetch every standing a player holds on the platform, in any region, including reserve positions
+func GetPlayerStandings(ctx context.Context, track *Track, platform int, playerId string) ([]Standing, error) {
+	return store.GetPlayerStandings(ctx, track, platform, playerId)
+}
+
+// Get a page of the medal holders for a region
+func GetTopTenMedalHolders(ctx context.Context, track *Track, platform int, region string, request PageRequest, sortBy string) (Page[Player], error) {
+	return store.GetTopTenMedalHolders(ctx, track, platform, region, request, sortBy)
+}
+
+// Fetch a player from the database, optionally creating one if they don't exist
+func GetPlayer(ctx context.Context, track *Track, platform int, region string, playerId string, username string, createIfAbsent bool) (*Player, error) {
+	return store.GetPlayer(ctx, track, platform, region, playerId, username, createIfAbsent)
+}
+
+// Fetch every score a player has stored on the platform, regardless of region
+func GetAllPlayerScores(ctx context.Context, track *Track, platform int, playerId string) ([]Score, error) {
+	return store.GetAllPlayerScores(ctx, track, platform, playerId)
+}
+
+// Fetch every region document held by a player on the platform
+func GetPlayerRegions(ctx context.Context, track *Track, platform int, playerId string) ([]Player, error) {
+	return store.GetPlayerRegions(ctx, track, platform, playerId)
+}
+
+// Fetch every player in a track, grouped by platform and region and ordered by medals
+func GetTrackStandings(ctx context.Context, track *Track) ([]Player, error) {
+	return store.GetTrackStandings(ctx, track)
+}
+
+// Return the rank a player would hold with the provided medals, among the other players in their platform and region
+//
+// Ranks are competition ranks, so players with equal medals share a rank and the next rank is skipped
+func GetMedalRank(ctx context.Context, track *Track, platform int, region string, playerId string, medals int) (int, error) {
+	return store.GetMedalRank(ctx, track, platform, region, playerId, medals)
+}
+
+// Fetch the players in a platform and region holding between the lower and upper medals inclusive, most medals first
+func GetPlayersWithinMedals(ctx context.Context, track *Track, platform int, region string, lower int, upper int) ([]Player, error) {
+	return store.GetPlayersWithinMedals(ctx, track, platform, region, lower, upper)
+}
+
+// Fetch the scores a player has stored on a leaderboard, normally only their best
+func GetLeaderboardScores(ctx context.Context, track *Track, platform int, leaderboardId string, playerId string) ([]Score, error) {
+	return store.GetLeaderboardScores(ctx, track, platform, leaderboardId, playerId)
+}
+
+// Insert a newly tracked score
+func InsertScore(ctx context.Context, track *Track, score Score) error {
+	return store.InsertScore(ctx, track, score)
+}
+
+// Delete a score that is no longer tracked
+func DeleteScore(ctx context.Context, track *Track, platform int, scoreId string) error {
+	return store.DeleteScore(ctx, track, platform, scoreId)
+}
+
+// Delete a score once no region's standings refer to it
+func DeleteUntrackedScore(ctx context.Context, track *Track, platform int, scoreId string) error {
+	return store.DeleteUntrackedScore(ctx, track, platform, scoreId)
+}
+
+// Delete every score a player has stored on the platform
+func DeletePlayerScores(ctx context.Context, track *Track, platform int, playerId string) error {
+	return store.DeletePlayerScores(ctx, track, platform, playerId)
+}
+
+// Add to the medals and position histograms of players in a region, creating any player who doesn't exist
+//
+// Every delta is applied together, returning the updated players in the same order as the deltas. If
+// an error stops the deltas being applied part way, the players of the deltas that were applied are
+// returned with it, holding only their ids, so their changes can still be recorded.
+func ApplyMedalDeltas(ctx context.Context, track *Track, platform int, region string, deltas []MedalDelta) ([]Player, error) {
+	return store.ApplyMedalDeltas(ctx, track, platform, region, deltas)
+}
+
+// Record changes in players' medals
+func InsertChanges(ctx context.Context, track *Track, changes []Change) error {
+	return store.InsertChanges(ctx, track, changes)
+}
+
+// Call fn with each player matching the filter, stopping at the first error
+func EachPlayer(ctx context.Context, track *Track, filter ExportFilter, fn func(Player) error) error {
+	return store.EachPlayer(ctx, track, filter, fn)
+}
+
+// Call fn with each score matching the filter, stopping at the first error
+//
+// Scores filtered by region are those standing in the region
+func EachScore(ctx context.Context, track *Track, filter ExportFilter, fn func(Score) error) error {
+	return store.EachScore(ctx, track, filter, fn)
+}
+
+// Call fn with each change matching the filter, stopping at the first error
+func EachChange(ctx context.Context, track *Track, filter ExportFilter, fn func(Change) error) error {
+	return store.EachChange(ctx, track, filter, fn)
+}
+
+// Call fn with each standing matching the filter, stopping at the first error
+func EachStanding(ctx context.Context, track *Track, filter ExportFilter, fn func(Standing) error) error {
+	return store.EachStanding(ctx, track, filter, fn)
+}
+
+// Store players, replacing any already stored in the same platform and region
+func UpsertPlayers(ctx context.Context, track *Track, players []Player) error {
+	return store.UpsertPlayers(ctx, track, players)
+}
+
+// Store scores, replacing any already stored with the same id
+func UpsertScores(ctx context.Context, track *Track, scores []Score) error {
+	return store.UpsertScores(ctx, track, scores)
+}
+
+// Store changes, replacing any already recorded for the same player, cause and time
+func UpsertChanges(ctx context.Context, track *Track, changes []Change) error {
+	return store.UpsertChanges(ctx, track, changes)
+}
+
+// Store standings, replacing any already stored for the same player on the leaderboard and region
+//
+// The cached standings of every leaderboard touched are dropped, so they are read afresh next time
+func UpsertStandings(ctx context.Context, track *Track, standings []Standing) error {
+	err := store.UpsertStandings(ctx, track, standings)
+	for _, standing := range standings {
+		cache.remove(standingsKey{track.Name, standing.Platform, standing.LeaderboardId, standing.Region})
+	}
+	return err
+}
+
+// Refresh a player's profile in every region of the track, recording any new username or country
+func UpdatePlayerProfile(ctx context.Context, track *Track, platform int, playerId string, profile PlayerProfile) error {
+	return store.UpdatePlayerProfile(ctx, track, platform, playerId, profile)
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Apply a single player's delta and record their change the way the engine did before deltas were batched
+type perPlayerApply func(ctx context.Context, track *Track, delta MedalDelta, change Change) error
+
+// Time applying the medal changes of a score that moves every player in a full top 10, as the engine does
+//
+// Each store is timed applying the changes one player at a time, reading each player before writing
+// them as the engine first did, and as a single batch
+func BenchmarkApplyMedalDeltas(b *testing.B) {
+	b.Run("sqlite", func(b *testing.B) {
+		benchmarkApplyMedalDeltas(b, func(b *testing.B) (Store, *Track, perPlayerApply) {
+			store := openTestSqliteStore(b)
+			return store, &Track{Name: "benchmark"}, store.applyPerPlayer
+		})
+	})
+	b.Run("mongo", func(b *testing.B) {
+		benchmarkApplyMedalDeltas(b, func(b *testing.B) (Store, *Track, perPlayerApply) {
+			return mongoStore{}, openTestMongoTrack(b, "benchmark"), mongoStore{}.applyPerPlayer
+		})
+	})
+}
+
+func benchmarkApplyMedalDeltas(b *testing.B, open func(*testing.B) (Store, *Track, perPlayerApply)) {
+	ctx := context.Background()
+	b.Run("per player", func(b *testing.B) {
+		_, track, apply := open(b)
+		for round := 0; b.Loop(); round++ {
+			deltas, changes := benchmarkRound(round)
+			for i := range deltas {
+				if err := apply(ctx, track, deltas[i], changes[i]); err != nil {
+					b.Fatalf("applying the delta of %s failed: %s", deltas[i].PlayerId, err)
+				}
+			}
+		}
+	})
+	b.Run("bulk", func(b *testing.B) {
+		store, track, _ := open(b)
+		for round := 0; b.Loop(); round++ {
+			deltas, changes := benchmarkRound(round)
+			if _, err := store.ApplyMedalDeltas(ctx, track, 1, GlobalRegion, deltas); err != nil {
+				b.Fatalf("ApplyMedalDeltas failed: %s", err)
+			}
+			if err := store.InsertChanges(ctx, track, changes); err != nil {
+				b.Fatalf("InsertChanges failed: %s", err)
+			}
+		}
+	})
+}
+
+// Read the player, set their medals and adjust their position histogram, then insert their change
+func (mongoStore) applyPerPlayer(ctx context.Context, track *Track, delta MedalDelta, change Change) error {
+	player, err := mongoStore{}.GetPlayer(ctx, track, 1, GlobalRegion, delta.PlayerId, "", true)
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": bson.M{"medals": player.Medals + delta.Medals}}
+	if len(delta.Positions) > 0 {
+		increments := bson.M{}
+		for position, count := range delta.Positions {
+			increments["positions."+position] = count
+		}
+		update["$inc"] = increments
+	}
+	if err = UpdateDocument(ctx, track.Players, bson.M{"playerId": delta.PlayerId, "platform": 1, "region": GlobalRegion}, update); err != nil {
+		return err
+	}
+	return InsertDocument(ctx, track.Changes, change)
+}
+
+// Read the player, set their medals and adjust their position histogram, then insert their change
+func (s *sqliteStore) applyPerPlayer(ctx context.Context, track *Track, delta MedalDelta, change Change) error {
+	player, err := s.GetPlayer(ctx, track, 1, GlobalRegion, delta.PlayerId, "", true)
+	if err != nil {
+		return err
+	}
+	transaction, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer transaction.Rollback()
+	var encoded string
+	if err = transaction.QueryRowContext(ctx, "SELECT positions FROM players WHERE track = ? AND platform = ? AND region = ? AND player_id = ?",
+		track.Name, 1, GlobalRegion, delta.PlayerId).Scan(&encoded); err != nil {
+		return err
+	}
+	positions := make(map[string]int)
+	if err = json.Unmarshal([]byte(encoded), &positions); err != nil {
+		return err
+	}
+	for position, count := range delta.Positions {
+		positions[position] += count
+	}
+	updated, err := json.Marshal(positions)
+	if err != nil {
+		return err
+	}
+	if _, err = transaction.ExecContext(ctx, "UPDATE players SET medals = ?, positions = ? WHERE track = ? AND platform = ? AND region = ? AND player_id = ?",
+		player.Medals+delta.Medals, string(updated), track.Name, 1, GlobalRegion, delta.PlayerId); err != nil {
+		return err
+	}
+	if err = transaction.Commit(); err != nil {
+		return err
+	}
+	// A change inserted on its own commits straight away, as the single insert it replaced did
+	return s.InsertChanges(ctx, track, []Change{change})
+}
+
+// The medals held by each position of a full top 10, as awarded by the engine
+var benchmarkMedals = []int{10, 8, 6, 5, 4, 3, 2, 1, 1, 1}
+
+// Build the deltas and changes of a new first place pushing every other player down a position
+func benchmarkRound(round int) ([]MedalDelta, []Change) {
+	var deltas []MedalDelta
+	var changes []Change
+	for position, medals := range benchmarkMedals {
+		playerId := "player" + strconv.Itoa((round+position)%(len(benchmarkMedals)*2))
+		gained := medals
+		positions := map[string]int{strconv.Itoa(position + 1): 1}
+		if position > 0 {
+			gained = medals - benchmarkMedals[position-1]
+			positions[strconv.Itoa(position)] = -1
+		}
+		deltas = append(deltas, MedalDelta{PlayerId: playerId, Medals: gained, Positions: positions})
+		changes = append(changes, Change{
+			Platform:            1,
+			PlayerId:            playerId,
+			Region:              GlobalRegion,
+			Timestamp:           int64(round),
+			MedalChange:         gained,
+			ResponsiblePlayerId: "player" + strconv.Itoa(round%(len(benchmarkMedals)*2)),
+			ResponsibleScoreId:  strconv.Itoa(round),
+			Reason:              "score",
+		})
+	}
+	return deltas, changes
+}
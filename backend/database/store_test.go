@@ -0,0 +1,580 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func TestMain(m *testing.M) {
+	// The timeouts are only set when the database is initialised, and would otherwise expire immediately
+	timeouts.read, timeouts.write, timeouts.aggregate, timeouts.migration = time.Minute, time.Minute, time.Minute, time.Minute
+	os.Exit(m.Run())
+}
+
+func TestSqliteStore(t *testing.T) {
+	if err := verifyStore(context.Background(), openTestSqliteStore(t), &Track{Name: "conformance"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMongoStore(t *testing.T) {
+	if err := verifyStore(context.Background(), mongoStore{}, openTestMongoTrack(t, "conformance")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppliedPlayers(t *testing.T) {
+	deltas := []MedalDelta{{PlayerId: "a", Medals: 10}, {PlayerId: "b", Medals: -2}, {PlayerId: "c", Medals: -8}}
+	for _, check := range []struct {
+		err      error
+		expected []string
+	}{
+		{fmt.Errorf("error writing documents: %w", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 2}}}}), []string{"a", "b"}},
+		{mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 0}}}}, []string{}},
+		{mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{}}, []string{"a", "b", "c"}},
+		{context.DeadlineExceeded, nil},
+	} {
+		var playerIds []string
+		for _, player := range appliedPlayers(1, GlobalRegion, deltas, check.err) {
+			playerIds = append(playerIds, player.PlayerId)
+		}
+		if !slices.Equal(playerIds, check.expected) {
+			t.Errorf("appliedPlayers after %q returned %v, expected %v", check.err, playerIds, check.expected)
+		}
+	}
+}
+
+// Open an empty SQLite store held in memory, closed once the test is done
+func openTestSqliteStore(tb testing.TB) *sqliteStore {
+	store, err := openSqliteStore(context.Background(), ":memory:")
+	if err != nil {
+		tb.Fatalf("error when opening the SQLite store: %s", err)
+	}
+	tb.Cleanup(func() { store.db.Close() })
+	return store
+}
+
+// Create an empty track in a MongoDB database of its own, dropped once the test is done
+//
+// MongoDB is only used when MONGO_URI is set, the test is skipped otherwise
+func openTestMongoTrack(tb testing.TB, name string) *Track {
+	databaseURI := os.Getenv("MONGO_URI")
+	if databaseURI == "" {
+		tb.Skip("MONGO_URI is unset")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(options.Client().ApplyURI(databaseURI))
+	if err != nil {
+		tb.Fatalf("error when connecting to MongoDB: %s", err)
+	}
+	database := client.Database("medalsaber_test_" + name)
+	tb.Cleanup(func() {
+		database.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	track := &Track{
+		Name:      name,
+		Scores:    database.Collection(name + "_scores"),
+		Standings: database.Collection(name + "_standings"),
+		Players:   database.Collection(name + "_players"),
+		Changes:   database.Collection(name + "_changes"),
+	}
+	if err = createTrackIndexes(ctx, track); err != nil {
+		tb.Fatal(err)
+	}
+	return track
+}
+
+// Check a store behaves as every store must, returning the first difference found
+//
+// The store should be empty, as the checks expect to find only what they have written
+func verifyStore(ctx context.Context, store Store, track *Track) error {
+	// Scores
+	if _, err := store.GetScore(ctx, track, 1, "missing"); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("GetScore of a missing score returned %v, expected ErrNotFound", err)
+	}
+	scores := []Score{
+		{ScoreId: "s1", PlayerId: "a", LeaderboardId: "l1", Platform: 1, Score: 300, MaxScore: 400, Timestamp: 1000, Modifiers: "", FullCombo: true, MaxCombo: 50},
+		{ScoreId: "s2", PlayerId: "b", LeaderboardId: "l1", Platform: 1, Score: 200, MaxScore: 400, Timestamp: 2000, Modifiers: "DA", BadCuts: 1, MaxCombo: 20},
+		{ScoreId: "s3", PlayerId: "a", LeaderboardId: "l2", Platform: 1, Score: 100, MaxScore: 400, Timestamp: 3000, MissedNotes: 2, MaxCombo: 10},
+	}
+	for _, score := range scores {
+		if err := store.InsertScore(ctx, track, score); err != nil {
+			return fmt.Errorf("InsertScore failed: %w", err)
+		}
+	}
+	score, err := store.GetScore(ctx, track, 1, "s2")
+	if err != nil || score != scores[1] {
+		return fmt.Errorf("GetScore returned %+v (%v), expected %+v", score, err, scores[1])
+	}
+	playerScores, err := store.GetAllPlayerScores(ctx, track, 1, "a")
+	if err != nil || len(playerScores) != 2 {
+		return fmt.Errorf("GetAllPlayerScores returned %d scores (%v), expected 2", len(playerScores), err)
+	}
+	// Leaderboards without any scores in the region have room for any score
+	within, err := store.IsWithinTopTen(ctx, track, 1, "l3", GlobalRegion, 1, 10)
+	if err != nil || !within {
+		return fmt.Errorf("IsWithinTopTen of an empty leaderboard returned %t (%v), expected true", within, err)
+	}
+	standings, err := store.GetStandings(ctx, track, 1, GlobalRegion, "l3", 10)
+	if err != nil || len(standings) != 0 {
+		return fmt.Errorf("GetStandings of an empty leaderboard returned %d standings (%v), expected none", len(standings), err)
+	}
+
+	// Standings, each region is kept separately
+	if err = store.SetStandings(ctx, track, 1, "l1", "GB", []Standing{
+		{Platform: 1, LeaderboardId: "l1", Region: "GB", Position: 1, ScoreId: "s1", PlayerId: "a", Score: 300, Timestamp: 1000},
+		{Platform: 1, LeaderboardId: "l1", Region: "GB", Position: 2, ScoreId: "s2", PlayerId: "b", Score: 200, Timestamp: 2000},
+	}); err != nil {
+		return fmt.Errorf("SetStandings failed: %w", err)
+	}
+	if err = store.SetStandings(ctx, track, 1, "l1", GlobalRegion, []Standing{
+		{Platform: 1, LeaderboardId: "l1", Region: GlobalRegion, Position: 1, ScoreId: "s1", PlayerId: "a", Score: 300, Timestamp: 1000},
+	}); err != nil {
+		return fmt.Errorf("SetStandings failed: %w", err)
+	}
+	standings, err = store.GetStandings(ctx, track, 1, "GB", "l1", 10)
+	if err != nil || len(standings) != 2 || standings[0].ScoreId != "s1" || standings[1].ScoreId != "s2" {
+		return fmt.Errorf("GetStandings returned %+v (%v), expected s1 then s2", standings, err)
+	}
+	if standings, err = store.GetStandings(ctx, track, 1, "GB", "l1", 1); err != nil || len(standings) != 1 {
+		return fmt.Errorf("GetStandings with a limit of 1 returned %d standings (%v)", len(standings), err)
+	}
+	if standings, err = store.GetStandings(ctx, track, 1, GlobalRegion, "l1", 10); err != nil || len(standings) != 1 {
+		return fmt.Errorf("GetStandings of another region returned %d standings (%v), expected 1", len(standings), err)
+	}
+	for _, check := range []struct {
+		score    int
+		depth    int
+		expected bool
+	}{
+		{250, 2, true},
+		{150, 2, false},
+		{200, 2, false},
+		{150, 3, true},
+	} {
+		within, err := store.IsWithinTopTen(ctx, track, 1, "l1", "GB", check.score, check.depth)
+		if err != nil || within != check.expected {
+			return fmt.Errorf("IsWithinTopTen of %d with depth %d returned %t (%v), expected %t", check.score, check.depth, within, err, check.expected)
+		}
+	}
+	// The most recently scored regions come first, with every one of their standings
+	standings, err = store.GetRecentStandings(ctx, track, 1)
+	if err != nil || len(standings) != 2 || standings[0].Region != "GB" || standings[0].ScoreId != "s1" || standings[1].ScoreId != "s2" {
+		return fmt.Errorf("GetRecentStandings of 1 region returned %+v (%v), expected s1 then s2 in GB", standings, err)
+	}
+	if standings, err = store.GetRecentStandings(ctx, track, 10); err != nil || len(standings) != 3 {
+		return fmt.Errorf("GetRecentStandings of 10 regions returned %d standings (%v), expected 3", len(standings), err)
+	}
+	// A player's standings are found in every region, whether or not they have a player document there
+	standings, err = store.GetPlayerStandings(ctx, track, 1, "a")
+	if err != nil || len(standings) != 2 || standings[0].Region != "GB" || standings[1].Region != GlobalRegion {
+		return fmt.Errorf("GetPlayerStandings returned %+v (%v), expected l1 in GB and %s", standings, err, GlobalRegion)
+	}
+	playerScores, err = pageItems(store.GetPlayerScores(ctx, track, &Player{Platform: 1, Region: "GB", PlayerId: "a"}, PageRequest{}, 0, 0))
+	if err != nil || len(playerScores) != 1 || playerScores[0].ScoreId != "s1" {
+		return fmt.Errorf("GetPlayerScores returned %+v (%v), expected only the standing score s1", playerScores, err)
+	}
+	if playerScores, err = store.GetLeaderboardScores(ctx, track, 1, "l1", "a"); err != nil || len(playerScores) != 1 {
+		return fmt.Errorf("GetLeaderboardScores returned %d scores (%v), expected 1", len(playerScores), err)
+	}
+	// Scores are only deleted once no region refers to them
+	if err = store.SetStandings(ctx, track, 1, "l1", "GB", []Standing{
+		{Platform: 1, LeaderboardId: "l1", Region: "GB", Position: 1, ScoreId: "s2", PlayerId: "b", Score: 200, Timestamp: 2000},
+	}); err != nil {
+		return fmt.Errorf("SetStandings failed: %w", err)
+	}
+	if err = store.DeleteUntrackedScore(ctx, track, 1, "s1"); err != nil {
+		return fmt.Errorf("DeleteUntrackedScore failed: %w", err)
+	}
+	if _, err = store.GetScore(ctx, track, 1, "s1"); err != nil {
+		return fmt.Errorf("GetScore of a score still standing in another region returned %v", err)
+	}
+	if err = store.SetStandings(ctx, track, 1, "l1", GlobalRegion, nil); err != nil {
+		return fmt.Errorf("SetStandings failed: %w", err)
+	}
+	if err = store.DeleteUntrackedScore(ctx, track, 1, "s1"); err != nil {
+		return fmt.Errorf("DeleteUntrackedScore failed: %w", err)
+	}
+	if _, err = store.GetScore(ctx, track, 1, "s1"); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("GetScore of an untracked score returned %v, expected ErrNotFound", err)
+	}
+	if err = store.DeleteScore(ctx, track, 1, "s2"); err != nil {
+		return fmt.Errorf("DeleteScore failed: %w", err)
+	}
+	if _, err = store.GetScore(ctx, track, 1, "s2"); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("GetScore of a deleted score returned %v, expected ErrNotFound", err)
+	}
+	if err = store.DeletePlayerScores(ctx, track, 1, "a"); err != nil {
+		return fmt.Errorf("DeletePlayerScores failed: %w", err)
+	}
+	if playerScores, err = store.GetAllPlayerScores(ctx, track, 1, "a"); err != nil || len(playerScores) != 0 {
+		return fmt.Errorf("GetAllPlayerScores after DeletePlayerScores returned %d scores (%v), expected none", len(playerScores), err)
+	}
+
+	// Players
+	if _, err = store.GetPlayer(ctx, track, 1, "GB", "a", "", false); !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("GetPlayer of a missing player returned %v, expected ErrNotFound", err)
+	}
+	for _, playerId := range []string{"a", "b", "c"} {
+		player, err := store.GetPlayer(ctx, track, 1, "GB", playerId, "player "+playerId, true)
+		if err != nil || player.PlayerId != playerId || player.Region != "GB" || player.Medals != 0 {
+			return fmt.Errorf("GetPlayer creating player %s returned %+v (%v)", playerId, player, err)
+		}
+	}
+	// Creating a player that exists returns the existing player
+	if _, err = store.GetPlayer(ctx, track, 1, "GB", "a", "player a", true); err != nil {
+		return fmt.Errorf("GetPlayer of an existing player failed: %w", err)
+	}
+	regions, err := store.GetPlayerRegions(ctx, track, 1, "a")
+	if err != nil || len(regions) != 1 {
+		return fmt.Errorf("GetPlayerRegions returned %d players (%v), expected 1", len(regions), err)
+	}
+	// Deltas add to what players already hold
+	players, err := store.ApplyMedalDeltas(ctx, track, 1, "GB", []MedalDelta{
+		{PlayerId: "a", Medals: 10, Positions: map[string]int{"1": 1}},
+		{PlayerId: "b", Medals: 12, Positions: map[string]int{"2": 2}},
+		{PlayerId: "c", Medals: 5, Positions: map[string]int{"3": 1}},
+	})
+	if err != nil || len(players) != 3 || players[0].PlayerId != "a" || players[1].Medals != 12 || players[2].Positions["3"] != 1 {
+		return fmt.Errorf("ApplyMedalDeltas returned %+v (%v), expected a, b and c with their deltas applied", players, err)
+	}
+	if players, err = store.ApplyMedalDeltas(ctx, track, 1, "GB", []MedalDelta{
+		{PlayerId: "b", Medals: -2, Positions: map[string]int{"2": -1}},
+	}); err != nil || len(players) != 1 || players[0].Medals != 10 {
+		return fmt.Errorf("ApplyMedalDeltas returned %+v (%v), expected b with 10 medals", players, err)
+	}
+	player, err := store.GetPlayer(ctx, track, 1, "GB", "b", "", false)
+	if err != nil || player.Medals != 10 || player.Positions["2"] != 1 {
+		return fmt.Errorf("GetPlayer after ApplyMedalDeltas returned %+v (%v), expected 10 medals and one second place", player, err)
+	}
+	if err = expectPlayerOrder(pageItems(store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{}, SortByMedals)))("a", "b", "c"); err != nil {
+		return fmt.Errorf("GetTopTenMedalHolders by medals: %w", err)
+	}
+	if err = expectPlayerOrder(pageItems(store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{}, SortByFirsts)))("a", "b", "c"); err != nil {
+		return fmt.Errorf("GetTopTenMedalHolders by firsts: %w", err)
+	}
+	// Pages follow on from each other through their cursors, in both directions
+	firstPage, err := store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{Limit: 2, IncludeTotal: true}, SortByMedals)
+	if err = expectPlayerOrder(firstPage.Items, err)("a", "b"); err != nil {
+		return fmt.Errorf("GetTopTenMedalHolders first page: %w", err)
+	}
+	if firstPage.Next == "" || firstPage.Prev != "" || firstPage.Total == nil || *firstPage.Total != 3 {
+		return fmt.Errorf("GetTopTenMedalHolders first page returned next %q, prev %q and total %v, expected only a next cursor and a total of 3",
+			firstPage.Next, firstPage.Prev, firstPage.Total)
+	}
+	secondPage, err := store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{Cursor: firstPage.Next, Limit: 2}, SortByMedals)
+	if err = expectPlayerOrder(secondPage.Items, err)("c"); err != nil {
+		return fmt.Errorf("GetTopTenMedalHolders second page: %w", err)
+	}
+	if secondPage.Next != "" || secondPage.Prev == "" || secondPage.Total != nil {
+		return fmt.Errorf("GetTopTenMedalHolders second page returned next %q, prev %q and total %v, expected only a prev cursor",
+			secondPage.Next, secondPage.Prev, secondPage.Total)
+	}
+	if err = expectPlayerOrder(pageItems(store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{Cursor: secondPage.Prev, Limit: 2}, SortByMedals)))("a", "b"); err != nil {
+		return fmt.Errorf("GetTopTenMedalHolders previous page: %w", err)
+	}
+	firstsPage, err := store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{Limit: 1}, SortByFirsts)
+	if err = expectPlayerOrder(pageItems(store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{Cursor: firstsPage.Next, Limit: 1}, SortByFirsts)))("b"); err != nil {
+		return fmt.Errorf("GetTopTenMedalHolders second page by firsts: %w", err)
+	}
+	// Cursors only work with the sort they were issued for
+	if _, err = store.GetTopTenMedalHolders(ctx, track, 1, "GB", PageRequest{Cursor: firstsPage.Next}, SortByMedals); err != ErrInvalidCursor {
+		return fmt.Errorf("GetTopTenMedalHolders with a cursor for another sort returned %v, expected %v", err, ErrInvalidCursor)
+	}
+	if err = expectPlayerOrder(store.GetTrackStandings(ctx, track))("a", "b", "c"); err != nil {
+		return fmt.Errorf("GetTrackStandings: %w", err)
+	}
+	// Tied players share a rank, and the next rank is skipped
+	for playerId, expected := range map[string]int{"a": 1, "b": 1, "c": 3} {
+		player, err := store.GetPlayer(ctx, track, 1, "GB", playerId, "", false)
+		if err != nil {
+			return fmt.Errorf("GetPlayer failed: %w", err)
+		}
+		rank, err := store.GetMedalRank(ctx, track, 1, "GB", playerId, player.Medals)
+		if err != nil || rank != expected {
+			return fmt.Errorf("GetMedalRank of player %s returned %d (%v), expected %d", playerId, rank, err, expected)
+		}
+	}
+	last, err := store.GetPlayer(ctx, track, 1, "GB", "c", "", false)
+	if err != nil {
+		return fmt.Errorf("GetPlayer failed: %w", err)
+	}
+	if err = expectPlayerOrder(store.GetPlayersWithinMedals(ctx, track, 1, "GB", last.Medals, last.Medals+1000))("a", "b", "c"); err != nil {
+		return fmt.Errorf("GetPlayersWithinMedals: %w", err)
+	}
+	if err = expectPlayerOrder(store.GetPlayersWithinMedals(ctx, track, 1, "GB", last.Medals, last.Medals))("c"); err != nil {
+		return fmt.Errorf("GetPlayersWithinMedals of the last player's medals: %w", err)
+	}
+
+	// Changes
+	var recorded []Change
+	for i, timestamp := range []int64{1000, 2000, 3000} {
+		recorded = append(recorded, Change{
+			Platform:            1,
+			PlayerId:            "a",
+			Region:              "GB",
+			Timestamp:           timestamp,
+			MedalChange:         i + 1,
+			ResponsiblePlayerId: "b",
+			Reason:              "score",
+		})
+	}
+	if err = store.InsertChanges(ctx, track, recorded); err != nil {
+		return fmt.Errorf("InsertChanges failed: %w", err)
+	}
+	changes, err := pageItems(store.GetChanges(ctx, track, 1, "GB", "a", PageRequest{}, 0, 0))
+	if err != nil || len(changes) != 3 || changes[0].Timestamp != 1000 || changes[2].MedalChange != 3 {
+		return fmt.Errorf("GetChanges returned %+v (%v), expected three changes in the order they were recorded", changes, err)
+	}
+	changePage, err := store.GetChanges(ctx, track, 1, "GB", "a", PageRequest{Limit: 2}, 0, 0)
+	if err != nil || len(changePage.Items) != 2 || changePage.Next == "" {
+		return fmt.Errorf("GetChanges first page returned %+v (%v), expected two changes and a next cursor", changePage, err)
+	}
+	changes, err = pageItems(store.GetChanges(ctx, track, 1, "GB", "a", PageRequest{Cursor: changePage.Next, Limit: 2}, 0, 0))
+	if err != nil || len(changes) != 1 || changes[0].Timestamp != 3000 {
+		return fmt.Errorf("GetChanges second page returned %+v (%v), expected only the change at 3000", changes, err)
+	}
+	changes, err = pageItems(store.GetChanges(ctx, track, 1, "GB", "a", PageRequest{}, 2000, 2000))
+	if err != nil || len(changes) != 1 || changes[0].Timestamp != 2000 {
+		return fmt.Errorf("GetChanges between timestamps returned %+v (%v), expected only the change at 2000", changes, err)
+	}
+
+	// Imports, which replace what is already stored, kept apart from the checks above on platform 2
+	importedScores := []Score{
+		{ScoreId: "s10", PlayerId: "x", LeaderboardId: "l9", Platform: 2, Score: 100, Timestamp: 500},
+		{ScoreId: "s11", PlayerId: "y", LeaderboardId: "l9", Platform: 2, Score: 90, Timestamp: 600},
+	}
+	importedChanges := []Change{
+		{Platform: 2, PlayerId: "x", Region: "FR", Timestamp: 500, MedalChange: 10, ResponsibleScoreId: "s10", Reason: "score"},
+		{Platform: 2, PlayerId: "y", Region: "DE", Timestamp: 600, MedalChange: 10, ResponsibleScoreId: "s11", Reason: "score"},
+	}
+	for range 2 {
+		if err = store.UpsertScores(ctx, track, importedScores); err != nil {
+			return fmt.Errorf("UpsertScores failed: %w", err)
+		}
+		if err = store.UpsertPlayers(ctx, track, []Player{{PlayerId: "x", Platform: 2, Region: "FR", Medals: 10, Positions: map[string]int{"1": 1}}}); err != nil {
+			return fmt.Errorf("UpsertPlayers failed: %w", err)
+		}
+		if err = store.UpsertChanges(ctx, track, importedChanges); err != nil {
+			return fmt.Errorf("UpsertChanges failed: %w", err)
+		}
+	}
+	if err = store.SetStandings(ctx, track, 2, "l9", "FR", []Standing{
+		{Platform: 2, LeaderboardId: "l9", Region: "FR", Position: 1, ScoreId: "s10", PlayerId: "x", Score: 100, Timestamp: 500},
+	}); err != nil {
+		return fmt.Errorf("SetStandings failed: %w", err)
+	}
+	for _, check := range []struct {
+		filter   ExportFilter
+		expected []string
+	}{
+		{ExportFilter{Platform: 2}, []string{"s10", "s11"}},
+		{ExportFilter{Platform: 2, Region: "FR"}, []string{"s10"}},
+		{ExportFilter{Platform: 2, After: 550}, []string{"s11"}},
+		{ExportFilter{Platform: 2, Region: "FR", After: 550}, nil},
+	} {
+		var scoreIds []string
+		if err = store.EachScore(ctx, track, check.filter, func(score Score) error {
+			scoreIds = append(scoreIds, score.ScoreId)
+			return nil
+		}); err != nil || !slices.Equal(scoreIds, check.expected) {
+			return fmt.Errorf("EachScore with filter %+v returned %v (%v), expected %v", check.filter, scoreIds, err, check.expected)
+		}
+	}
+	var exportedPlayers []Player
+	if err = store.EachPlayer(ctx, track, ExportFilter{Platform: 2}, func(player Player) error {
+		exportedPlayers = append(exportedPlayers, player)
+		return nil
+	}); err != nil || len(exportedPlayers) != 1 || exportedPlayers[0].Medals != 10 || exportedPlayers[0].Positions["1"] != 1 {
+		return fmt.Errorf("EachPlayer returned %+v (%v), expected only x, imported once", exportedPlayers, err)
+	}
+	var exportedChanges []Change
+	if err = store.EachChange(ctx, track, ExportFilter{Platform: 2, Region: "DE"}, func(change Change) error {
+		exportedChanges = append(exportedChanges, change)
+		return nil
+	}); err != nil || len(exportedChanges) != 1 || exportedChanges[0].PlayerId != "y" {
+		return fmt.Errorf("EachChange in DE returned %+v (%v), expected only the change of y, imported once", exportedChanges, err)
+	}
+	for range 2 {
+		if err = store.UpsertStandings(ctx, track, []Standing{
+			{Platform: 2, LeaderboardId: "l9", Region: "DE", Position: 1, ScoreId: "s11", PlayerId: "y", Score: 90, Timestamp: 600},
+		}); err != nil {
+			return fmt.Errorf("UpsertStandings failed: %w", err)
+		}
+	}
+	for _, check := range []struct {
+		filter   ExportFilter
+		expected []string
+	}{
+		{ExportFilter{Platform: 2}, []string{"s10", "s11"}},
+		{ExportFilter{Platform: 2, Region: "DE"}, []string{"s11"}},
+		{ExportFilter{Platform: 2, Before: 550}, []string{"s10"}},
+	} {
+		var scoreIds []string
+		if err = store.EachStanding(ctx, track, check.filter, func(standing Standing) error {
+			scoreIds = append(scoreIds, standing.ScoreId)
+			return nil
+		}); err != nil || !slices.Equal(scoreIds, check.expected) {
+			return fmt.Errorf("EachStanding with filter %+v returned %v (%v), expected %v", check.filter, scoreIds, err, check.expected)
+		}
+	}
+
+	// Rollups, replacing the changes of whole days, every change above was recorded on the first day
+	if err = store.InsertChanges(ctx, track, []Change{
+		{Platform: 1, PlayerId: "r", Region: "NL", Timestamp: 1000, MedalChange: 3, ResponsiblePlayerId: "b", ResponsibleScoreId: "s1", Reason: "score"},
+		{Platform: 1, PlayerId: "r", Region: "NL", Timestamp: 2000, MedalChange: -2, ResponsiblePlayerId: "c", ResponsibleScoreId: "s2", Reason: "score"},
+		{Platform: 1, PlayerId: "r", Region: "NL", Timestamp: 3000, MedalChange: 1, ResponsiblePlayerId: "b", ResponsibleScoreId: "s3", Reason: "score"},
+		{Platform: 1, PlayerId: "r", Region: "NL", Timestamp: rollupDay + 500, MedalChange: 4, ResponsiblePlayerId: "b", ResponsibleScoreId: "s4", Reason: "score"},
+	}); err != nil {
+		return fmt.Errorf("InsertChanges failed: %w", err)
+	}
+	if rolledUp, err := rollUpChanges(ctx, store, track, rollupDay+600); err != nil || rolledUp != 8 {
+		return fmt.Errorf("rolling up changes rolled up %d (%v), expected the 8 changes of the first day", rolledUp, err)
+	}
+	changes, err = pageItems(store.GetChanges(ctx, track, 1, "NL", "r", PageRequest{}, 0, 0))
+	if err != nil || len(changes) != 2 || changes[0].Rollup == nil || changes[1].Rollup != nil || changes[1].Timestamp != rollupDay+500 {
+		return fmt.Errorf("GetChanges after rolling up returned %+v (%v), expected a rollup then the raw change of the second day", changes, err)
+	}
+	rollup := changes[0]
+	expectedResponsible := []ResponsibleTotal{{PlayerId: "b", MedalChange: 4, Changes: 2}, {PlayerId: "c", MedalChange: -2, Changes: 1}}
+	if rollup.Timestamp != 0 || rollup.Reason != ChangeReasonRollup || rollup.MedalChange != 2 || rollup.Rollup.Gains != 4 || rollup.Rollup.Losses != 2 ||
+		rollup.Rollup.Changes != 3 || !slices.Equal(rollup.Rollup.TopResponsible, expectedResponsible) {
+		return fmt.Errorf("rollup was %+v (%+v), expected a net change of 2 from gains of 4 and losses of 2, mostly by b", rollup, rollup.Rollup)
+	}
+	// Changes added to a rolled up day are folded into its rollup
+	if err = store.InsertChanges(ctx, track, []Change{
+		{Platform: 1, PlayerId: "r", Region: "NL", Timestamp: 1500, MedalChange: -5, ResponsiblePlayerId: "d", ResponsibleScoreId: "s5", Reason: "score"},
+	}); err != nil {
+		return fmt.Errorf("InsertChanges failed: %w", err)
+	}
+	if rolledUp, err := rollUpChanges(ctx, store, track, rollupDay+600); err != nil || rolledUp != 1 {
+		return fmt.Errorf("rolling up a rolled up day again rolled up %d (%v), expected only the new change", rolledUp, err)
+	}
+	if rolledUp, err := rollUpChanges(ctx, store, track, rollupDay+600); err != nil || rolledUp != 0 {
+		return fmt.Errorf("rolling up with nothing new rolled up %d (%v), expected nothing", rolledUp, err)
+	}
+	changes, err = pageItems(store.GetChanges(ctx, track, 1, "NL", "r", PageRequest{}, 0, 0))
+	if err != nil || len(changes) != 2 || changes[0].MedalChange != -3 || changes[0].Rollup.Losses != 7 || changes[0].Rollup.Changes != 4 ||
+		changes[0].Rollup.TopResponsible[0].PlayerId != "d" {
+		return fmt.Errorf("GetChanges after rolling up again returned %+v (%v), expected one rollup with a net change of -3, mostly by d", changes, err)
+	}
+
+	// Profiles, updated in every region of the player and recording each new username and country
+	if _, err = store.GetPlayer(ctx, track, 1, "US", "a", "player a", true); err != nil {
+		return fmt.Errorf("GetPlayer creating player a in US failed: %w", err)
+	}
+	tag, other := "TAG", "OTHER"
+	for _, profile := range []PlayerProfile{
+		{Username: "alpha", Country: "GB", PP: 100, Rank: 5, Clan: &tag, Timestamp: 10},
+		{Username: "alpha", Timestamp: 20},
+		{Username: "alpha2", Timestamp: 30},
+	} {
+		if err = store.UpdatePlayerProfile(ctx, track, 1, "a", profile); err != nil {
+			return fmt.Errorf("UpdatePlayerProfile failed: %w", err)
+		}
+	}
+	for _, region := range []string{"GB", "US"} {
+		player, err = store.GetPlayer(ctx, track, 1, region, "a", "", false)
+		if err != nil || player.Username != "alpha2" || player.Country != "GB" || player.PP != 100 || player.Rank != 5 || player.Clan != tag ||
+			len(player.UsernameHistory) != 2 || player.UsernameHistory[1] != (UsernameRecord{Username: "alpha2", Timestamp: 30}) ||
+			len(player.CountryHistory) != 1 || player.CountryHistory[0] != (CountryRecord{Country: "GB", Timestamp: 10}) {
+			return fmt.Errorf("GetPlayer in %s after UpdatePlayerProfile returned %+v (%v), expected alpha2 of TAG with two usernames and one country", region, player, err)
+		}
+	}
+
+	// Clans, totalled from the medals of their members in a region
+	for playerId, clan := range map[string]*string{"b": &tag, "c": &other} {
+		if err = store.UpdatePlayerProfile(ctx, track, 1, playerId, PlayerProfile{Username: "player " + playerId, Clan: clan}); err != nil {
+			return fmt.Errorf("UpdatePlayerProfile failed: %w", err)
+		}
+	}
+	clanStandings, err := pageItems(store.GetClanStandings(ctx, track, 1, "GB", PageRequest{}, SortByMedals))
+	expectedClans := []ClanStanding{{Clan: tag, Medals: 20, Firsts: 1, Members: 2}, {Clan: other, Medals: 5, Members: 1}}
+	if err != nil || !slices.Equal(clanStandings, expectedClans) {
+		return fmt.Errorf("GetClanStandings returned %+v (%v), expected %+v", clanStandings, err, expectedClans)
+	}
+	clanPage, err := store.GetClanStandings(ctx, track, 1, "GB", PageRequest{Limit: 1, IncludeTotal: true}, SortByFirsts)
+	if err != nil || len(clanPage.Items) != 1 || clanPage.Items[0].Clan != tag || clanPage.Next == "" || clanPage.Total == nil || *clanPage.Total != 2 {
+		return fmt.Errorf("GetClanStandings first page by firsts returned %+v (%v), expected TAG, a next cursor and a total of 2", clanPage, err)
+	}
+	clanStandings, err = pageItems(store.GetClanStandings(ctx, track, 1, "GB", PageRequest{Cursor: clanPage.Next, Limit: 1}, SortByFirsts))
+	if err != nil || len(clanStandings) != 1 || clanStandings[0].Clan != other {
+		return fmt.Errorf("GetClanStandings second page by firsts returned %+v (%v), expected only OTHER", clanStandings, err)
+	}
+	if clanStanding, err := store.GetClanStanding(ctx, track, 1, "GB", "NONE"); err != nil || clanStanding != (ClanStanding{Clan: "NONE"}) {
+		return fmt.Errorf("GetClanStanding of a missing clan returned %+v (%v), expected an empty standing", clanStanding, err)
+	}
+	if err = expectPlayerOrder(pageItems(store.GetClanMembers(ctx, track, 1, "GB", tag, PageRequest{})))("a", "b"); err != nil {
+		return fmt.Errorf("GetClanMembers: %w", err)
+	}
+	memberPage, err := store.GetClanMembers(ctx, track, 1, "GB", tag, PageRequest{Limit: 1})
+	if err != nil {
+		return fmt.Errorf("GetClanMembers first page failed: %w", err)
+	}
+	if err = expectPlayerOrder(pageItems(store.GetClanMembers(ctx, track, 1, "GB", tag, PageRequest{Cursor: memberPage.Next, Limit: 1})))("b"); err != nil {
+		return fmt.Errorf("GetClanMembers second page: %w", err)
+	}
+	playerClans, err := store.GetPlayerClans(ctx, track, 1, []string{"a", "c", "z"})
+	if err != nil || len(playerClans) != 2 || playerClans["a"] != tag || playerClans["c"] != other {
+		return fmt.Errorf("GetPlayerClans returned %v (%v), expected a in TAG and c in OTHER", playerClans, err)
+	}
+
+	// The ledger, read by achievements and rivalries, kept on a day after every change above
+	day := 3 * rollupDay
+	if err = store.InsertChanges(ctx, track, []Change{
+		{Platform: 1, PlayerId: "c", Region: "GB", Timestamp: day, MedalChange: -2, ResponsibleLeaderboardId: "l1", ResponsiblePlayerId: "a", Reason: "score"},
+		{Platform: 1, PlayerId: "c", Region: "GB", Timestamp: day + 1, MedalChange: -1, ResponsibleLeaderboardId: "l2", ResponsiblePlayerId: "a", Reason: "score"},
+		{Platform: 1, PlayerId: "c", Region: "GB", Timestamp: day + 2, MedalChange: 2, ResponsibleLeaderboardId: "l1", ResponsiblePlayerId: "c", Reason: "score"},
+		{Platform: 1, PlayerId: "c", Region: "GB", Timestamp: day + 3, MedalChange: -3, ResponsibleLeaderboardId: "l1", ResponsiblePlayerId: "b", Reason: "ban"},
+	}); err != nil {
+		return fmt.Errorf("InsertChanges failed: %w", err)
+	}
+	if sniped, err := store.WasSniped(ctx, track, 1, "GB", "c", "l1", day); err != nil || !sniped {
+		return fmt.Errorf("WasSniped returned %t (%v), expected true", sniped, err)
+	}
+	if sniped, err := store.WasSniped(ctx, track, 1, "GB", "c", "l1", day-1); err != nil || sniped {
+		return fmt.Errorf("WasSniped before the snipe returned %t (%v), expected false", sniped, err)
+	}
+	gains, err := store.GetPlayerGains(ctx, track, 1, "GB", "c")
+	if err != nil || len(gains) != 1 || gains[0].Timestamp != day+2 {
+		return fmt.Errorf("GetPlayerGains returned %+v (%v), expected only the gain from c's own score", gains, err)
+	}
+	rivalries, err := store.GetSnipeTotals(ctx, track)
+	expectedRivalries := []Rivalry{{Platform: 1, Region: "GB", PlayerId: "c", SniperId: "a", Snipes: 2, MedalsLost: 3}}
+	if err != nil || !slices.Equal(rivalries, expectedRivalries) {
+		return fmt.Errorf("GetSnipeTotals returned %+v (%v), expected %+v", rivalries, err, expectedRivalries)
+	}
+	return nil
+}
+
+// Return the results of a page, for checks that don't look at its cursors
+func pageItems[T any](page Page[T], err error) ([]T, error) {
+	return page.Items, err
+}
+
+// Return a check that the players were returned in the expected order
+func expectPlayerOrder(players []Player, err error) func(playerIds ...string) error {
+	return func(playerIds ...string) error {
+		if err != nil {
+			return err
+		}
+		if len(players) != len(playerIds) {
+			return fmt.Errorf("returned %d players, expected %d", len(players), len(playerIds))
+		}
+		for i, playerId := range playerIds {
+			if players[i].PlayerId != playerId {
+				return fmt.Errorf("returned player %s at position %d, expected %s", players[i].PlayerId, i+1, playerId)
+			}
+		}
+		return nil
+	}
+}
@@ -1,5 +1,10 @@
 package database
 
+import "context"
+
+// The region every score counts towards, regardless of the player's country
+const GlobalRegion = "Global"
+
 type Score struct {
 	ScoreId       string `bson:"scoreId"`
 	PlayerId      string `bson:"playerId"`
@@ -11,17 +16,50 @@ type Score struct {
 	Modifiers     string `bson:"modifiers"`
 	BadCuts       int    `bson:"badCuts"`
 	MissedNotes   int    `bson:"missedNotes"`
+	FullCombo     bool   `bson:"fullCombo"`
+	MaxCombo      int    `bson:"maxCombo"`
 }
 
 // Get the player who set the score
-func (score *Score) GetPlayer(region string) *Player {
-	player, err := GetPlayer(score.Platform, score.PlayerId, region, "", true)
+func (score *Score) GetPlayer(ctx context.Context, track *Track, region string) *Player {
+	player, err := GetPlayer(ctx, track, score.Platform, region, score.PlayerId, "", true)
 	if err != nil {
 		return nil
 	}
 	return player
 }
 
+// Standing struct ----------------
+
+// A score's place on a leaderboard within a region, every region a score counts in has its own standing
+type Standing struct {
+	Platform      int    `bson:"platform"`
+	LeaderboardId string `bson:"leaderboardId"`
+	Region        string `bson:"region"`
+	// The place the score holds, 1 for first place
+	Position  int    `bson:"position"`
+	ScoreId   string `bson:"scoreId"`
+	PlayerId  string `bson:"playerId"`
+	Score     int    `bson:"score"`
+	Timestamp int64  `bson:"timestamp"`
+}
+
+// Archived score struct ----------------
+
+// A previous best that was replaced by an improvement or pushed out of the tracked positions
+type ArchivedScore struct {
+	Score  `bson:",inline"`
+	Region string `bson:"region"`
+	// The position the score held when it was archived, 1 for first place
+	Position int `bson:"position"`
+	// The medals the score was worth when it was archived
+	Medals     int    `bson:"medals"`
+	ArchivedAt int64  `bson:"archivedAt"`
+	Reason     string `bson:"reason"`
+	// The score that replaced or displaced it
+	ReplacedByScoreId string `bson:"replacedByScoreId"`
+}
+
 // Player struct ----------------
 
 type Player struct {
@@ -30,6 +68,32 @@ type Player struct {
 	Region   string `bson:"region"`
 	Medals   int    `bson:"medals"`
 	Username string `bson:"username"`
+	// How many times the player holds each position, keyed by position ("1" for first place)
+	Positions map[string]int `bson:"positions"`
+	// Profile details, refreshed from each score the player sets
+	Avatar          string           `bson:"avatar"`
+	Country         string           `bson:"country"`
+	PP              float64          `bson:"pp"`
+	Rank            int              `bson:"rank"`
+	Role            string           `bson:"role"`
+	UsernameHistory []UsernameRecord `bson:"usernameHistory"`
+	CountryHistory  []CountryRecord  `bson:"countryHistory"`
+	// The tag of the player's primary clan, only BeatLeader has clans
+	Clan string `bson:"clan"`
+	// The player's rank by medals within their platform and region, worked out when the player is returned
+	MedalRank int `bson:"-"`
+}
+
+// A username held by a player, and when it was first seen
+type UsernameRecord struct {
+	Username  string `bson:"username"`
+	Timestamp int64  `bson:"timestamp"`
+}
+
+// A country a player was from, and when it was first seen
+type CountryRecord struct {
+	Country   string `bson:"country"`
+	Timestamp int64  `bson:"timestamp"`
 }
 
 // Change struct ----------------
@@ -43,4 +107,200 @@ type Change struct {
 	ResponsibleLeaderboardId string `bson:"responsibleLeaderboardId"`
 	ResponsiblePlayerId      string `bson:"responsiblePlayerId"`
 	ResponsibleScoreId       string `bson:"responsibleScoreId"`
+	Reason                   string `bson:"reason"`
+	// The ids of any achievements the change earned the player
+	Achievements []string `bson:"achievements"`
+	// Set on the daily rollups that replace changes older than the retention period, nil on raw changes
+	Rollup *ChangeRollup `bson:"rollup,omitempty"`
+}
+
+// The reason given to a rollup, which is dated to the start of the day it covers (UTC) and whose
+// medal change is the net change over that day
+const ChangeReasonRollup = "rollup"
+
+// A summary of a player's changes in a region over a day
+type ChangeRollup struct {
+	// The medals gained and lost over the day, both positive
+	Gains  int `bson:"gains"`
+	Losses int `bson:"losses"`
+	// The number of changes rolled up
+	Changes int `bson:"changes"`
+	// The players responsible for the most medals moving, by the size of their net change
+	TopResponsible []ResponsibleTotal `bson:"topResponsible"`
+	// The ids of the raw changes folded in that may not be deleted yet, so rolling up the day again
+	// doesn't count them twice. Only kept by MongoDB, which can't replace the changes in a transaction
+	Folded []string `bson:"folded,omitempty" json:"-"`
+}
+
+// The medals a player moved for another over a day
+type ResponsibleTotal struct {
+	PlayerId    string `bson:"playerId"`
+	MedalChange int    `bson:"medalChange"`
+	Changes     int    `bson:"changes"`
+}
+
+// Rank change struct ----------------
+
+// A player moving between medal ranks within a region
+type RankChange struct {
+	Platform                 int    `bson:"platform"`
+	PlayerId                 string `bson:"playerId"`
+	Region                   string `bson:"region"`
+	Timestamp                int64  `bson:"timestamp"`
+	FromRank                 int    `bson:"fromRank"`
+	ToRank                   int    `bson:"toRank"`
+	Medals                   int    `bson:"medals"`
+	ResponsibleLeaderboardId string `bson:"responsibleLeaderboardId"`
+}
+
+// Leaderboard struct ----------------
+
+type Leaderboard struct {
+	Platform      int     `bson:"platform"`
+	LeaderboardId string  `bson:"leaderboardId"`
+	SongName      string  `bson:"songName"`
+	SongSubName   string  `bson:"songSubName"`
+	SongAuthor    string  `bson:"songAuthor"`
+	Mapper        string  `bson:"mapper"`
+	SongHash      string  `bson:"songHash"`
+	Difficulty    string  `bson:"difficulty"`
+	GameMode      string  `bson:"gameMode"`
+	Stars         float64 `bson:"stars"`
+	CoverImage    string  `bson:"coverImage"`
+	MaxScore      int     `bson:"maxScore"`
+}
+
+// Ban struct ----------------
+
+type Ban struct {
+	Platform  int    `bson:"platform"`
+	PlayerId  string `bson:"playerId"`
+	Timestamp int64  `bson:"timestamp"`
+	Reason    string `bson:"reason"`
+}
+
+// Season struct ----------------
+
+type Season struct {
+	SeasonId string `bson:"seasonId"`
+	Start    int64  `bson:"start"`
+	End      int64  `bson:"end"`
+	Archived bool   `bson:"archived"`
+}
+
+// Get the track the season's standings are kept in
+func (season *Season) GetTrack() *Track {
+	return GetTrack("season_" + season.SeasonId)
+}
+
+// Return whether the timestamp falls within the season
+func (season *Season) Contains(timestamp int64) bool {
+	return timestamp >= season.Start && timestamp < season.End
+}
+
+// Season standing struct ----------------
+
+type SeasonStanding struct {
+	SeasonId  string         `bson:"seasonId"`
+	Platform  int            `bson:"platform"`
+	Region    string         `bson:"region"`
+	PlayerId  string         `bson:"playerId"`
+	Username  string         `bson:"username"`
+	Rank      int            `bson:"rank"`
+	Medals    int            `bson:"medals"`
+	Positions map[string]int `bson:"positions"`
+}
+
+// Snapshot struct ----------------
+
+// The medal standings of a region at a point in time
+type Snapshot struct {
+	Platform  int             `bson:"platform"`
+	Region    string          `bson:"region"`
+	Timestamp int64           `bson:"timestamp"`
+	Entries   []SnapshotEntry `bson:"entries"`
+}
+
+// A single player's standing within a snapshot, stored with short keys to keep snapshots compact
+type SnapshotEntry struct {
+	PlayerId string `bson:"p"`
+	Rank     int    `bson:"r"`
+	Medals   int    `bson:"m"`
+}
+
+// A player's standing at the time of a snapshot
+type PlayerHistoryPoint struct {
+	Timestamp int64 `bson:"timestamp"`
+	Rank      int   `bson:"rank"`
+	Medals    int   `bson:"medals"`
+}
+
+// Achievement struct ----------------
+
+// An achievement awarded to a player
+type Achievement struct {
+	Platform      int    `bson:"platform"`
+	PlayerId      string `bson:"playerId"`
+	AchievementId string `bson:"achievementId"`
+	Name          string `bson:"name"`
+	Region        string `bson:"region"`
+	Timestamp     int64  `bson:"timestamp"`
+}
+
+// Rivalry struct ----------------
+
+// How many times, and for how many medals, one player has been sniped by another in a region
+type Rivalry struct {
+	Platform   int    `bson:"platform"`
+	Region     string `bson:"region"`
+	PlayerId   string `bson:"playerId"`
+	SniperId   string `bson:"sniperId"`
+	Snipes     int    `bson:"snipes"`
+	MedalsLost int    `bson:"medalsLost"`
+}
+
+// The snipes exchanged between two players in a region
+type HeadToHead struct {
+	PlayerId string
+	RivalId  string
+	// How the rival has sniped the player
+	SnipedBy Rivalry
+	// How the player has sniped the rival
+	Sniped Rivalry
+	// Medals the player has taken from the rival, less those the rival has taken from the player
+	NetMedals int
+}
+
+// Clan structs ----------------
+
+// The player holding first place on a leaderboard in a region
+type MapLeader struct {
+	Platform      int    `bson:"platform"`
+	LeaderboardId string `bson:"leaderboardId"`
+	Region        string `bson:"region"`
+	PlayerId      string `bson:"playerId"`
+	Timestamp     int64  `bson:"timestamp"`
+}
+
+// The combined standing of a clan's members within a region
+type ClanStanding struct {
+	Clan    string `bson:"_id"`
+	Medals  int    `bson:"medals"`
+	Firsts  int    `bson:"firsts"`
+	Members int    `bson:"members"`
+}
+
+// How many first places a clan holds on a leaderboard, across every region
+type MapClan struct {
+	Clan   string `bson:"_id"`
+	Firsts int    `bson:"firsts"`
+}
+
+// Migration struct ----------------
+
+// A migration that has been applied to the database
+type AppliedMigration struct {
+	Version   int    `bson:"version"`
+	Name      string `bson:"name"`
+	AppliedAt int64  `bson:"appliedAt"`
 }
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"log"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// A set of collections that medal standings are kept in
+//
+// The lifetime standings use the main collections, while every other track (such as a
+// season) keeps its standings in collections prefixed with the track's name
+type Track struct {
+	Name      string
+	Scores    *mongo.Collection
+	Standings *mongo.Collection
+	Players   *mongo.Collection
+	Changes   *mongo.Collection
+}
+
+// The name of the lifetime track
+const LifetimeTrack = "lifetime"
+
+// The lifetime standings, set once the database has been initialised
+var Lifetime *Track
+
+// Fetch the track with the provided name
+func GetTrack(name string) *Track {
+	if name == LifetimeTrack {
+		return Lifetime
+	}
+	// Without MongoDB the track is only ever used with the SQLite store, which just needs its name
+	if !MongoEnabled() {
+		return &Track{Name: name}
+	}
+	track := &Track{
+		Name:      name,
+		Scores:    Database.Collection(name + "_scores"),
+		Standings: Database.Collection(name + "_standings"),
+		Players:   Database.Collection(name + "_players"),
+		Changes:   Database.Collection(name + "_changes"),
+	}
+	// Tracks are looked up outside of any request, so their indexes are bound to the process instead. The
+	// track can still be used without them, and creating them is tried again on the next lookup
+	if err := createTrackIndexes(processContext, track); err != nil {
+		log.Printf("error when creating the indexes of track %s: %s\n", name, err)
+	}
+	return track
+}
@@ -0,0 +1,124 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// A column of a CSV file, holding one exported field of a record
+type field struct {
+	name  string
+	index int
+}
+
+// Return the fields of a record that are stored, in the order they are declared
+//
+// Column names are the Go field names, the same keys NDJSON uses
+func fieldsOf[T any]() []field {
+	recordType := reflect.TypeFor[T]()
+	var fields []field
+	for i := range recordType.NumField() {
+		structField := recordType.Field(i)
+		if !structField.IsExported() || structField.Tag.Get("bson") == "-" {
+			continue
+		}
+		fields = append(fields, field{name: structField.Name, index: i})
+	}
+	return fields
+}
+
+func fieldNames(fields []field) []string {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = field.name
+	}
+	return names
+}
+
+// Match the columns of a CSV header to the fields of a record, columns may be in any order
+func columnFields[T any](header []string) ([]field, error) {
+	byName := make(map[string]field)
+	for _, field := range fieldsOf[T]() {
+		byName[field.name] = field
+	}
+	seen := make(map[string]bool)
+	columns := make([]field, len(header))
+	for i, name := range header {
+		field, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		seen[name] = true
+		columns[i] = field
+	}
+	return columns, nil
+}
+
+// Format each field of a record as a cell, fields that aren't plain values are written as JSON
+func formatRow[T any](fields []field, record T) ([]string, error) {
+	value := reflect.ValueOf(record)
+	row := make([]string, len(fields))
+	for i, field := range fields {
+		fieldValue := value.Field(field.index)
+		switch fieldValue.Kind() {
+		case reflect.String:
+			row[i] = fieldValue.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			row[i] = strconv.FormatInt(fieldValue.Int(), 10)
+		case reflect.Float32, reflect.Float64:
+			row[i] = strconv.FormatFloat(fieldValue.Float(), 'g', -1, 64)
+		case reflect.Bool:
+			row[i] = strconv.FormatBool(fieldValue.Bool())
+		default:
+			encoded, err := json.Marshal(fieldValue.Interface())
+			if err != nil {
+				return nil, fmt.Errorf("error when encoding %s: %w", field.name, err)
+			}
+			row[i] = string(encoded)
+		}
+	}
+	return row, nil
+}
+
+// Set the fields of a record from the cells of a row, empty cells leave fields at their zero value
+func parseRow[T any](columns []field, row []string, record *T) error {
+	value := reflect.ValueOf(record).Elem()
+	for i, field := range columns {
+		cell := row[i]
+		if cell == "" {
+			continue
+		}
+		fieldValue := value.Field(field.index)
+		var err error
+		switch fieldValue.Kind() {
+		case reflect.String:
+			fieldValue.SetString(cell)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			var parsed int64
+			if parsed, err = strconv.ParseInt(cell, 10, fieldValue.Type().Bits()); err == nil {
+				fieldValue.SetInt(parsed)
+			}
+		case reflect.Float32, reflect.Float64:
+			var parsed float64
+			if parsed, err = strconv.ParseFloat(cell, fieldValue.Type().Bits()); err == nil {
+				fieldValue.SetFloat(parsed)
+			}
+		case reflect.Bool:
+			var parsed bool
+			if parsed, err = strconv.ParseBool(cell); err == nil {
+				fieldValue.SetBool(parsed)
+			}
+		default:
+			err = json.Unmarshal([]byte(cell), fieldValue.Addr().Interface())
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", field.name, cell, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package dataset
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A record holding each kind of field a CSV cell can hold
+type csvRecord struct {
+	Name    string
+	Count   int
+	Ratio   float64
+	Passed  bool
+	Tags    []string
+	Ignored string `bson:"-"`
+}
+
+func TestCsvRoundTrip(t *testing.T) {
+	fields := fieldsOf[csvRecord]()
+	if names := fieldNames(fields); !slices.Equal(names, []string{"Name", "Count", "Ratio", "Passed", "Tags"}) {
+		t.Fatalf("fieldsOf returned %v", names)
+	}
+	record := csvRecord{Name: `a, "b"`, Count: -3, Ratio: 0.25, Passed: true, Tags: []string{"x"}, Ignored: "left out"}
+	row, err := formatRow(fields, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(row, []string{`a, "b"`, "-3", "0.25", "true", `["x"]`}) {
+		t.Fatalf("formatRow returned %q", row)
+	}
+	// Columns may come in any order
+	columns, err := columnFields[csvRecord]([]string{"Tags", "Passed", "Ratio", "Count", "Name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Reverse(row)
+	var parsed csvRecord
+	if err = parseRow(columns, row, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	record.Ignored = ""
+	if !reflect.DeepEqual(parsed, record) {
+		t.Fatalf("parseRow returned %+v, expected %+v", parsed, record)
+	}
+}
+
+func TestCsvErrors(t *testing.T) {
+	tests := []struct {
+		header []string
+		row    []string
+		err    string
+	}{
+		{header: []string{"Name", "Ignored"}, err: `unknown column "Ignored"`},
+		{header: []string{"Name", "Name"}, err: `duplicate column "Name"`},
+		{header: []string{"Count"}, row: []string{"1.5"}, err: `invalid Count "1.5"`},
+		{header: []string{"Passed"}, row: []string{"maybe"}, err: `invalid Passed "maybe"`},
+		{header: []string{"Tags"}, row: []string{"[x"}, err: `invalid Tags "[x"`},
+	}
+	for _, test := range tests {
+		columns, err := columnFields[csvRecord](test.header)
+		if err == nil {
+			err = parseRow(columns, test.row, &csvRecord{})
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("reading %v %v returned %v, expected %q", test.header, test.row, err, test.err)
+		}
+	}
+}
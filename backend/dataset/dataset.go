@@ -0,0 +1,329 @@
+package dataset
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// The kinds of record that can be exported and imported
+const (
+	KindPlayers      = "players"
+	KindScores       = "scores"
+	KindChanges      = "changes"
+	KindStandings    = "standings"
+	KindLeaderboards = "leaderboards"
+)
+
+// The formats records can be written in
+const (
+	// One JSON object per line
+	FormatNdjson = "ndjson"
+	// A header row naming the fields, then one row per record
+	FormatCsv = "csv"
+)
+
+// The content type of each format, for serving exports over HTTP
+var ContentTypes = map[string]string{
+	FormatNdjson: "application/x-ndjson",
+	FormatCsv:    "text/csv",
+}
+
+// Returned when asked for a kind of record or a format that doesn't exist
+var (
+	ErrUnknownKind   = errors.New("unknown kind, use players, scores, changes, standings or leaderboards")
+	ErrUnknownFormat = errors.New("unknown format, use ndjson or csv")
+)
+
+// The number of records imported at once
+const importBatchSize = 500
+
+// Write every record of a kind matching the filter to the writer, returning how many were written
+//
+// Leaderboards aren't kept per track, so the track is ignored for them
+func Export(ctx context.Context, track *database.Track, kind string, format string, filter database.ExportFilter, writer io.Writer) (int, error) {
+	switch kind {
+	case KindPlayers:
+		return export(format, writer, func(fn func(database.Player) error) error {
+			return database.EachPlayer(ctx, track, filter, fn)
+		})
+	case KindScores:
+		return export(format, writer, func(fn func(database.Score) error) error {
+			return database.EachScore(ctx, track, filter, fn)
+		})
+	case KindChanges:
+		return export(format, writer, func(fn func(database.Change) error) error {
+			return database.EachChange(ctx, track, filter, fn)
+		})
+	case KindStandings:
+		return export(format, writer, func(fn func(database.Standing) error) error {
+			return database.EachStanding(ctx, track, filter, fn)
+		})
+	case KindLeaderboards:
+		return export(format, writer, func(fn func(database.Leaderboard) error) error {
+			return database.EachLeaderboard(ctx, filter, fn)
+		})
+	}
+	return 0, ErrUnknownKind
+}
+
+// Read records of a kind from the reader and store them, returning how many were imported
+//
+// Records replace any already stored with the same key, so importing the same data again changes
+// nothing. Every record is read and validated before any are stored, so an invalid record anywhere
+// imports nothing.
+//
+// Standings aren't derived from imported scores, so scores should be imported along with the
+// standings exported with them, or the leaderboards will have no places until they are next scored on.
+func Import(ctx context.Context, track *database.Track, kind string, format string, reader io.Reader) (int, error) {
+	switch kind {
+	case KindPlayers:
+		return importRecords(reader, format, validatePlayer, func(players []database.Player) error {
+			return database.UpsertPlayers(ctx, track, players)
+		})
+	case KindScores:
+		return importRecords(reader, format, validateScore, func(scores []database.Score) error {
+			return database.UpsertScores(ctx, track, scores)
+		})
+	case KindChanges:
+		return importRecords(reader, format, validateChange, func(changes []database.Change) error {
+			return database.UpsertChanges(ctx, track, changes)
+		})
+	case KindStandings:
+		return importRecords(reader, format, validateStanding, func(standings []database.Standing) error {
+			return database.UpsertStandings(ctx, track, standings)
+		})
+	case KindLeaderboards:
+		return importRecords(reader, format, validateLeaderboard, func(leaderboards []database.Leaderboard) error {
+			return database.UpsertLeaderboards(ctx, leaderboards)
+		})
+	}
+	return 0, ErrUnknownKind
+}
+
+// Write each record produced by each to the writer in the format
+func export[T any](format string, writer io.Writer, each func(func(T) error) error) (int, error) {
+	count := 0
+	switch format {
+	case FormatNdjson:
+		buffered := bufio.NewWriter(writer)
+		encoder := json.NewEncoder(buffered)
+		err := each(func(record T) error {
+			count++
+			return encoder.Encode(record)
+		})
+		if err != nil {
+			return count, err
+		}
+		return count, buffered.Flush()
+	case FormatCsv:
+		fields := fieldsOf[T]()
+		csvWriter := csv.NewWriter(writer)
+		if err := csvWriter.Write(fieldNames(fields)); err != nil {
+			return 0, err
+		}
+		err := each(func(record T) error {
+			count++
+			row, err := formatRow(fields, record)
+			if err != nil {
+				return err
+			}
+			return csvWriter.Write(row)
+		})
+		if err != nil {
+			return count, err
+		}
+		csvWriter.Flush()
+		return count, csvWriter.Error()
+	}
+	return 0, ErrUnknownFormat
+}
+
+// Read and validate every record from the reader, then store them in batches
+//
+// The reader is spooled to a temporary file while validating, so it can be read again to store the records
+func importRecords[T any](reader io.Reader, format string, validate func(T) error, store func([]T) error) (int, error) {
+	spool, err := os.CreateTemp("", "medalsaber-import-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	next, err := recordReader[T](io.TeeReader(reader, spool), format)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		record, line, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = validate(record)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if next, err = recordReader[T](bufio.NewReader(spool), format); err != nil {
+		return 0, err
+	}
+	imported := 0
+	var batch []T
+	for {
+		record, line, err := next()
+		if err == io.EOF {
+			break
+		}
+		// The spool holds what was already read, so this only fails if the file does
+		if err != nil {
+			return imported, fmt.Errorf("line %d: %w", line, err)
+		}
+		if batch = append(batch, record); len(batch) == importBatchSize {
+			if err = store(batch); err != nil {
+				return imported, err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err = store(batch); err != nil {
+			return imported, err
+		}
+		imported += len(batch)
+	}
+	return imported, nil
+}
+
+// Return a function reading the next record and the line it was on, or io.EOF once there are none left
+func recordReader[T any](reader io.Reader, format string) (func() (T, int, error), error) {
+	switch format {
+	case FormatNdjson:
+		scanner := bufio.NewScanner(reader)
+		// Players with long histories can make for long lines
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		line := 0
+		return func() (T, int, error) {
+			var record T
+			for scanner.Scan() {
+				line++
+				if strings.TrimSpace(scanner.Text()) == "" {
+					continue
+				}
+				decoder := json.NewDecoder(strings.NewReader(scanner.Text()))
+				decoder.DisallowUnknownFields()
+				return record, line, decoder.Decode(&record)
+			}
+			if err := scanner.Err(); err != nil {
+				return record, line, err
+			}
+			return record, line, io.EOF
+		}, nil
+	case FormatCsv:
+		csvReader := csv.NewReader(reader)
+		header, err := csvReader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("line 1: %w", err)
+		}
+		columns, err := columnFields[T](header)
+		if err != nil {
+			return nil, fmt.Errorf("line 1: %w", err)
+		}
+		return func() (T, int, error) {
+			var record T
+			row, err := csvReader.Read()
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					return record, parseErr.Line, parseErr.Err
+				}
+				return record, 0, err
+			}
+			line, _ := csvReader.FieldPos(0)
+			return record, line, parseRow(columns, row, &record)
+		}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+/*
+ * Validation of imported records, so an import can't store anything the engine couldn't have
+ */
+
+func validatePlatform(platform int) error {
+	if platform != 1 && platform != 2 {
+		return fmt.Errorf("invalid platform %d, use 1 for ScoreSaber or 2 for Beatleader", platform)
+	}
+	return nil
+}
+
+func validatePlayer(player database.Player) error {
+	switch {
+	case player.PlayerId == "":
+		return errors.New("PlayerId is required")
+	case player.Region == "":
+		return errors.New("Region is required")
+	case player.Medals < 0:
+		return fmt.Errorf("player %s has negative medals", player.PlayerId)
+	}
+	return validatePlatform(player.Platform)
+}
+
+func validateScore(score database.Score) error {
+	switch {
+	case score.ScoreId == "":
+		return errors.New("ScoreId is required")
+	case score.PlayerId == "":
+		return errors.New("PlayerId is required")
+	case score.LeaderboardId == "":
+		return errors.New("LeaderboardId is required")
+	}
+	return validatePlatform(score.Platform)
+}
+
+func validateChange(change database.Change) error {
+	switch {
+	case change.PlayerId == "":
+		return errors.New("PlayerId is required")
+	case change.Region == "":
+		return errors.New("Region is required")
+	case change.Reason == "":
+		return errors.New("Reason is required")
+	}
+	return validatePlatform(change.Platform)
+}
+
+func validateStanding(standing database.Standing) error {
+	switch {
+	case standing.LeaderboardId == "":
+		return errors.New("LeaderboardId is required")
+	case standing.Region == "":
+		return errors.New("Region is required")
+	case standing.ScoreId == "":
+		return errors.New("ScoreId is required")
+	case standing.PlayerId == "":
+		return errors.New("PlayerId is required")
+	case standing.Position < 1:
+		return fmt.Errorf("standing of %s has position %d, positions are numbered from 1", standing.PlayerId, standing.Position)
+	}
+	return validatePlatform(standing.Platform)
+}
+
+func validateLeaderboard(leaderboard database.Leaderboard) error {
+	if leaderboard.LeaderboardId == "" {
+		return errors.New("LeaderboardId is required")
+	}
+	return validatePlatform(leaderboard.Platform)
+}
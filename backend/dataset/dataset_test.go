@@ -0,0 +1,78 @@
+package dataset
+
+import (
+	"strings"
+	"testing"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+func TestImportRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		input    string
+		imported int
+		stored   []string
+		err      string
+	}{
+		{
+			name:     "ndjson",
+			format:   FormatNdjson,
+			input:    "{\"LeaderboardId\":\"a\",\"Platform\":1}\n\n{\"LeaderboardId\":\"b\",\"Platform\":2}\n",
+			imported: 2,
+			stored:   []string{"a", "b"},
+		},
+		{
+			name:     "csv",
+			format:   FormatCsv,
+			input:    "Platform,LeaderboardId\n1,a\n2,b\n",
+			imported: 2,
+			stored:   []string{"a", "b"},
+		},
+		{
+			name:   "invalid record after the first batch",
+			format: FormatCsv,
+			input:  "Platform,LeaderboardId\n" + strings.Repeat("1,a\n", importBatchSize+1) + "3,b\n",
+			err:    "line 503: invalid platform 3, use 1 for ScoreSaber or 2 for Beatleader",
+		},
+		{
+			name:   "unknown field",
+			format: FormatNdjson,
+			input:  "{\"LeaderboardId\":\"a\",\"Platform\":1}\n{\"Leaderboard\":\"b\"}\n",
+			err:    "line 2: json: unknown field \"Leaderboard\"",
+		},
+		{
+			name:   "unknown format",
+			format: "xml",
+			err:    ErrUnknownFormat.Error(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stored []string
+			imported, err := importRecords(strings.NewReader(test.input), test.format, validateLeaderboard, func(leaderboards []database.Leaderboard) error {
+				for _, leaderboard := range leaderboards {
+					stored = append(stored, leaderboard.LeaderboardId)
+				}
+				return nil
+			})
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("importRecords returned %v, expected %q", err, test.err)
+				}
+				// Nothing is stored unless every record is valid
+				if imported != 0 || len(stored) != 0 {
+					t.Fatalf("importRecords stored %d records from invalid input", len(stored))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if imported != test.imported || strings.Join(stored, ",") != strings.Join(test.stored, ",") {
+				t.Fatalf("importRecords stored %v (%d), expected %v (%d)", stored, imported, test.stored, test.imported)
+			}
+		})
+	}
+}
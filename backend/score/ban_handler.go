@@ -0,0 +1,275 @@
+package score
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"nonetaken.dev/medalsaber/database"
+)
+
+// The most pages of a platform's leaderboard read when looking for a score to refill a region, enough to
+// get past the tracked positions with room for scores that are skipped
+const refillPageLimit = 10
+
+// Ban a player on the provided platform
+//
+// This function will:
+// - record the ban so any future scores from the player are ignored
+// - remove the player's scores from every region they stand in, including reserve positions
+// - promote every player who was below the banned player, including from the reserve
+// - refill the vacated 10th place from the platform's REST API if the reserve is empty
+// - record the medal changes for all affected players
+//
+// Banning a player who is already banned finishes removing anything of theirs still standing, so a ban
+// that failed partway through can be retried
+func BanPlayer(ctx context.Context, platform int, playerId string, reason string) error {
+	if !database.MongoEnabled() {
+		return database.ErrMongoDisabled
+	}
+	banned, err := database.IsBanned(ctx, platform, playerId)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().UnixMilli()
+	// Record the ban first so no new scores slip in while we clean up
+	if !banned {
+		if err = database.InsertDocument(ctx, database.Collections.Bans, database.Ban{
+			Platform:  platform,
+			PlayerId:  playerId,
+			Timestamp: timestamp,
+			Reason:    reason,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, track := range standingTracks() {
+		if err = removePlayerFromTrack(ctx, track, platform, playerId, timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove all of a banned player's scores from a track
+//
+// The regions are found from the standings the player holds rather than their player documents, as a
+// player holding only reserve positions in a region has no document there
+func removePlayerFromTrack(ctx context.Context, track *database.Track, platform int, playerId string, timestamp int64) error {
+	standings, err := database.GetPlayerStandings(ctx, track, platform, playerId)
+	if err != nil {
+		return err
+	}
+	scores, err := database.GetAllPlayerScores(ctx, track, platform, playerId)
+	if err != nil {
+		return err
+	}
+	scoresById := make(map[string]database.Score, len(scores))
+	for _, score := range scores {
+		scoresById[score.ScoreId] = score
+	}
+	// Remove the player's score from each region it stands in
+	for _, standing := range standings {
+		removedScore, ok := scoresById[standing.ScoreId]
+		if !ok {
+			removedScore = database.Score{
+				ScoreId:       standing.ScoreId,
+				PlayerId:      standing.PlayerId,
+				LeaderboardId: standing.LeaderboardId,
+				Platform:      standing.Platform,
+				Score:         standing.Score,
+				Timestamp:     standing.Timestamp,
+			}
+		}
+		if err = removeScoreFromRegion(ctx, track, removedScore, standing.Region, changeCause{
+			platform:      removedScore.Platform,
+			leaderboardId: removedScore.LeaderboardId,
+			playerId:      removedScore.PlayerId,
+			scoreId:       removedScore.ScoreId,
+			timestamp:     timestamp,
+			reason:        ChangeReasonBan,
+		}); err != nil {
+			return err
+		}
+	}
+	// Finally, delete the scores themselves
+	if err = database.DeletePlayerScores(ctx, track, platform, playerId); err != nil {
+		return err
+	}
+	log.Printf("banned player %s (platform: %d) has had %d standings removed from track %s", playerId, platform, len(standings), track.Name)
+	return nil
+}
+
+// Lift a ban from a player on the provided platform
+//
+// Removed scores are not restored, the player will earn medals again as they set new scores
+func UnbanPlayer(ctx context.Context, platform int, playerId string) error {
+	if !database.MongoEnabled() {
+		return database.ErrMongoDisabled
+	}
+	banned, err := database.IsBanned(ctx, platform, playerId)
+	if err != nil {
+		return err
+	}
+	if !banned {
+		return fmt.Errorf("player %s is not banned", playerId)
+	}
+	return database.DeleteDocument(ctx, database.Collections.Bans, bson.M{
+		"platform": platform,
+		"playerId": playerId,
+	})
+}
+
+// Remove a single score, such as one deleted or unranked on the platform, promoting everyone below it
+func RemoveScore(ctx context.Context, platform int, scoreId string) error {
+	found := false
+	for _, track := range standingTracks() {
+		removedScore, err := database.GetScore(ctx, track, platform, scoreId)
+		// The score doesn't count towards this track
+		if err == database.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+		if err = removeScoreFromTrack(ctx, track, removedScore); err != nil {
+			return err
+		}
+	}
+	if !found {
+		return database.ErrNotFound
+	}
+	return nil
+}
+
+// Remove a single score from every region of a track it stands in
+func removeScoreFromTrack(ctx context.Context, track *database.Track, removedScore database.Score) error {
+	standings, err := database.GetPlayerStandings(ctx, track, removedScore.Platform, removedScore.PlayerId)
+	if err != nil {
+		return err
+	}
+	cause := changeCause{
+		platform:      removedScore.Platform,
+		leaderboardId: removedScore.LeaderboardId,
+		playerId:      removedScore.PlayerId,
+		scoreId:       removedScore.ScoreId,
+		timestamp:     time.Now().UnixMilli(),
+		reason:        ChangeReasonRemoval,
+	}
+	for _, standing := range standings {
+		if standing.ScoreId != removedScore.ScoreId {
+			continue
+		}
+		if err = removeScoreFromRegion(ctx, track, removedScore, standing.Region, cause); err != nil {
+			return err
+		}
+	}
+	return database.DeleteScore(ctx, track, removedScore.Platform, removedScore.ScoreId)
+}
+
+// Remove the provided score from a region's tracked scores, promoting everyone below it
+//
+// An error is returned if the standings couldn't be read or replaced, leaving the score in place
+func removeScoreFromRegion(ctx context.Context, track *database.Track, removedScore database.Score, region string, cause changeCause) error {
+	trackedPositions := TrackedPositions()
+	standings, err := database.GetStandings(ctx, track, removedScore.Platform, region, removedScore.LeaderboardId, int64(trackedPositions))
+	if err != nil {
+		return fmt.Errorf("error when getting standings of leaderboard %s in %s: %w", removedScore.LeaderboardId, region, err)
+	}
+	position := isPlayerWithinTopTen(standings, removedScore.PlayerId)
+	// The score isn't counted in this region, nothing to do
+	if position == -1 {
+		return nil
+	}
+	medalDeltas := make(map[string]int)
+	positionDeltas := make(map[string]map[int]int)
+	// The removed player loses the medals for their position entirely
+	medalDeltas[removedScore.PlayerId] = -MedalValues[position]
+	movePosition(positionDeltas, removedScore.PlayerId, position, -1)
+	// Everyone below moves up a position, promoting the best reserve score into the top 10
+	for i := position + 1; i < len(standings); i++ {
+		medalDeltas[standings[i].PlayerId] += MedalValues[i-1] - MedalValues[i]
+		movePosition(positionDeltas, standings[i].PlayerId, i, i-1)
+	}
+	// If every tracked position was held, the bottom one is now empty, so try to find someone from the
+	// platform to take it. Otherwise the reserve would run dry and the top 10 couldn't be refilled later
+	var refillScore ScoreMessage
+	remainingStandings := append(append([]database.Standing{}, standings[:position]...), standings[position+1:]...)
+	if len(standings) >= trackedPositions && len(remainingStandings) < trackedPositions {
+		refillScore = findRefillScore(ctx, track, removedScore.Platform, removedScore.LeaderboardId, region, remainingStandings)
+		if refillScore != nil {
+			// The score may already be stored if it was set in the player's own region
+			_, err = database.GetScore(ctx, track, refillScore.GetPlatform(), refillScore.GetScoreId())
+			if err == database.ErrNotFound {
+				if err = database.InsertScore(ctx, track, convertIntoDatabaseScore(refillScore)); err != nil {
+					log.Printf("error when inserting refill score: %s\n", err)
+				}
+			}
+			medalDeltas[refillScore.GetPlayerId()] += MedalValues[len(remainingStandings)]
+			movePosition(positionDeltas, refillScore.GetPlayerId(), -1, len(remainingStandings))
+			remainingStandings = append(remainingStandings, database.Standing{
+				Platform:      refillScore.GetPlatform(),
+				LeaderboardId: refillScore.GetLeaderboardId(),
+				Region:        region,
+				ScoreId:       refillScore.GetScoreId(),
+				PlayerId:      refillScore.GetPlayerId(),
+				Score:         refillScore.GetScore(),
+				Timestamp:     refillScore.GetTimestamp(),
+			})
+		}
+	}
+	if err = database.SetStandings(ctx, track, removedScore.Platform, removedScore.LeaderboardId, region, numberStandings(remainingStandings)); err != nil {
+		return fmt.Errorf("error when saving standings of leaderboard %s in %s: %w", removedScore.LeaderboardId, region, err)
+	}
+	handleMedalChanges(ctx, track, medalDeltas, positionDeltas, cause, region)
+	// Make sure the promoted player has a profile stored
+	if refillScore != nil {
+		handleProfileUpdateForTrack(ctx, track, refillScore)
+	}
+	log.Printf("removed score %s from player %s (platform: %d, region: %s, track: %s) on leaderboard %s, which held position %d",
+		removedScore.ScoreId, removedScore.PlayerId, removedScore.Platform, region, track.Name, removedScore.LeaderboardId, position)
+	return nil
+}
+
+// Find the best score from the platform that can fill the place below the remaining standings
+//
+// The platform's leaderboard is paged through until a score below the remaining standings is found, as
+// the first pages only hold the scores already placed. Will return nil if no suitable score could be found
+func findRefillScore(ctx context.Context, track *database.Track, platform int, leaderboardId string, region string, remainingStandings []database.Standing) ScoreMessage {
+	lowestScore := remainingStandings[len(remainingStandings)-1].Score
+	for page := 1; page <= refillPageLimit; page++ {
+		candidates, err := fetchLeaderboardScores(ctx, platform, leaderboardId, region, page)
+		// ScoreSaber answers a page past the last score with not found rather than an empty page
+		if errors.Is(err, errRestNotFound) {
+			return nil
+		}
+		if err != nil {
+			log.Printf("error when fetching leaderboard %s to refill region %s: %s\n", leaderboardId, region, err)
+			return nil
+		}
+		// Every score on the leaderboard has been checked
+		if len(candidates) == 0 {
+			return nil
+		}
+		for _, candidate := range candidates {
+			// Skip anyone who is already placed or who would be placed above the remaining scores
+			if isPlayerWithinTopTen(remainingStandings, candidate.GetPlayerId()) != -1 || candidate.GetScore() > lowestScore {
+				continue
+			}
+			// Skip scores that don't count towards the track, such as those set outside a season
+			if !trackAccepts(ctx, track, candidate) {
+				continue
+			}
+			banned, err := database.IsBanned(ctx, platform, candidate.GetPlayerId())
+			if err != nil || banned {
+				continue
+			}
+			return candidate
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package score
 
 import (
 	"strconv"
+	"strings"
 )
 
 type BeatLeaderResponse struct {
@@ -104,6 +105,56 @@ func (message *BeatLeaderResponse) GetBadCuts() int {
 func (message *BeatLeaderResponse) GetMissedNotes() int {
 	return message.MissedNotes
 }
+func (message *BeatLeaderResponse) IsFullCombo() bool {
+	return message.FullCombo
+}
+func (message *BeatLeaderResponse) GetMaxCombo() int {
+	return message.MaxCombo
+}
+func (message *BeatLeaderResponse) GetSongSubName() string {
+	return message.Leaderboard.Song.SubName
+}
+func (message *BeatLeaderResponse) GetSongAuthor() string {
+	return message.Leaderboard.Song.Author
+}
+func (message *BeatLeaderResponse) GetMapper() string {
+	return message.Leaderboard.Song.Mapper
+}
+func (message *BeatLeaderResponse) GetSongHash() string {
+	return message.Leaderboard.Song.Hash
+}
+func (message *BeatLeaderResponse) GetGameMode() string {
+	return message.Leaderboard.Difficulty.ModeName
+}
+func (message *BeatLeaderResponse) GetStars() float64 {
+	return message.Leaderboard.Difficulty.Stars
+}
+func (message *BeatLeaderResponse) GetCoverImage() string {
+	return message.Leaderboard.Song.CoverImage
+}
+func (message *BeatLeaderResponse) GetPlayerAvatar() string {
+	return message.Player.Avatar
+}
+func (message *BeatLeaderResponse) GetPlayerPP() float64 {
+	return message.Player.Pp
+}
+func (message *BeatLeaderResponse) GetPlayerRank() int {
+	return message.Player.Rank
+}
+func (message *BeatLeaderResponse) GetPlayerRole() string {
+	return message.Player.Role
+}
+
+// The player's primary clan is the first in their chosen clan order, or their first clan if they haven't chosen one
+func (message *BeatLeaderResponse) GetPlayerClan() string {
+	if tag, _, _ := strings.Cut(message.Player.ClanOrder, ","); tag != "" {
+		return strings.TrimSpace(tag)
+	}
+	if len(message.Player.Clans) > 0 {
+		return message.Player.Clans[0].Tag
+	}
+	return ""
+}
 
 type ContextExtension struct {
 	ID               int              `json:"id"`
@@ -265,7 +316,14 @@ type BeatLeaderPlayer struct {
 	PatreonFeatures   any                       `json:"patreonFeatures"`
 	ProfileSettings   BeatLeaderProfileSettings `json:"profileSettings"`
 	ClanOrder         string                    `json:"clanOrder"`
-	Clans             []any                     `json:"clans"`
+	Clans             []BeatLeaderClan          `json:"clans"`
+}
+
+type BeatLeaderClan struct {
+	ID    int    `json:"id"`
+	Tag   string `json:"tag"`
+	Color string `json:"color"`
+	Name  string `json:"name"`
 }
 
 type BeatLeaderProfileSettings struct {
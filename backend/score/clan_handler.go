@@ -0,0 +1,32 @@
+package score
+
+import (
+	"context"
+	"log"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// Keep track of who holds first place on the leaderboard, so clans can be credited for it
+func handleMapLeader(ctx context.Context, playerId string, positionDeltas map[int]int, cause changeCause, region string) {
+	// The player has taken first place
+	if positionDeltas[0] > 0 {
+		if err := database.SetMapLeader(ctx, database.MapLeader{
+			Platform:      cause.platform,
+			LeaderboardId: cause.leaderboardId,
+			Region:        region,
+			PlayerId:      playerId,
+			Timestamp:     cause.timestamp,
+		}); err != nil {
+			log.Printf("error when setting leader of leaderboard %s: %s\n", cause.leaderboardId, err)
+		}
+		return
+	}
+	// The player has lost first place, this only removes them while they're still recorded as the
+	// leader, so it doesn't matter whether the new leader was handled first
+	if positionDeltas[0] < 0 {
+		if err := database.RemoveMapLeader(ctx, cause.platform, cause.leaderboardId, region, playerId); err != nil {
+			log.Printf("error when removing leader of leaderboard %s: %s\n", cause.leaderboardId, err)
+		}
+	}
+}
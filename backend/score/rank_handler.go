@@ -0,0 +1,95 @@
+package score
+
+import (
+	"context"
+	"log"
+	"sort"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// Record every player whose medal rank in a region moved when the deltas were applied, both the players whose
+// medals changed and the players they moved past
+//
+// The players should reflect the deltas already being applied. Ranks before the deltas are worked out from the
+// same read as the ranks after them, so both come from one snapshot of the region.
+func handleRankChanges(ctx context.Context, platform int, region string, players []database.Player, deltas []database.MedalDelta, cause changeCause) {
+	// Only players holding medals between the lowest and highest counts moved can have changed rank
+	previousMedals := make(map[string]int)
+	lower, upper := -1, -1
+	for i, player := range players {
+		if deltas[i].Medals == 0 {
+			continue
+		}
+		previous := player.Medals - deltas[i].Medals
+		previousMedals[player.PlayerId] = previous
+		if lower == -1 {
+			lower, upper = previous, previous
+		}
+		lower = min(lower, previous, player.Medals)
+		upper = max(upper, previous, player.Medals)
+	}
+	if len(previousMedals) == 0 {
+		return
+	}
+	// Players above the range are ahead both before and after the deltas
+	rank, err := database.GetMedalRank(ctx, database.Lifetime, platform, region, "", upper)
+	if err != nil {
+		log.Printf("error when getting rank above %d medals in %s: %s\n", upper, region, err)
+		return
+	}
+	ahead := rank - 1
+	affected, err := database.GetPlayersWithinMedals(ctx, database.Lifetime, platform, region, lower, upper)
+	if err != nil {
+		log.Printf("error when getting players between %d and %d medals in %s: %s\n", lower, upper, region, err)
+		return
+	}
+	// The medals held within the range before and after the deltas, in ascending order
+	before := make([]int, len(affected))
+	after := make([]int, len(affected))
+	for i, player := range affected {
+		before[i] = previousMedalsOf(previousMedals, player)
+		after[i] = player.Medals
+	}
+	sort.Ints(before)
+	sort.Ints(after)
+	var rankChanges []any
+	for _, player := range affected {
+		fromRank := ahead + countAbove(before, previousMedalsOf(previousMedals, player)) + 1
+		toRank := ahead + countAbove(after, player.Medals) + 1
+		if fromRank == toRank {
+			continue
+		}
+		rankChanges = append(rankChanges, database.RankChange{
+			Platform:                 platform,
+			PlayerId:                 player.PlayerId,
+			Region:                   region,
+			Timestamp:                cause.timestamp,
+			FromRank:                 fromRank,
+			ToRank:                   toRank,
+			Medals:                   player.Medals,
+			ResponsibleLeaderboardId: cause.leaderboardId,
+		})
+	}
+	if len(rankChanges) == 0 {
+		return
+	}
+	if err = database.InsertManyDocuments(ctx, database.Collections.RankChanges, rankChanges); err != nil {
+		log.Printf("error when inserting rank changes: %s\n", err)
+		return
+	}
+	log.Printf("%d players (platform: %d) moved rank in %s", len(rankChanges), platform, region)
+}
+
+// Return the medals a player held before the deltas were applied
+func previousMedalsOf(previousMedals map[string]int, player database.Player) int {
+	if previous, ok := previousMedals[player.PlayerId]; ok {
+		return previous
+	}
+	return player.Medals
+}
+
+// Count the medal counts above the provided medals, the counts must be in ascending order
+func countAbove(medals []int, than int) int {
+	return len(medals) - sort.SearchInts(medals, than+1)
+}
@@ -0,0 +1,108 @@
+package score
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Base URLs for each platform's REST API
+const (
+	scoresaberApiUrl = "https://scoresaber.com/api"
+	beatleaderApiUrl = "https://api.beatleader.com"
+)
+
+// The number of scores requested per page from BeatLeader
+const beatleaderPageSize = 20
+
+// Returned when the platform has nothing at the requested URL, such as a page past the last score
+var errRestNotFound = errors.New("not found")
+
+// Shared HTTP client for REST requests so a slow platform can't hang the engine
+var restClient = &http.Client{Timeout: 10 * time.Second}
+
+/*
+ * Structs for the leaderboard score REST endpoints
+ */
+type scoresaberLeaderboardScores struct {
+	Scores []ScoresaberScore `json:"scores"`
+}
+
+type beatleaderLeaderboardScores struct {
+	Scores []BeatLeaderResponse `json:"scores"`
+}
+
+// Fetch a page of scores for a leaderboard and region from the platform's REST API, starting from page 1
+//
+// The scores are returned in leaderboard order, best first, and a page past the last score is empty
+func fetchLeaderboardScores(ctx context.Context, platform int, leaderboardId string, region string, page int) ([]ScoreMessage, error) {
+	var countryFilter string
+	if region != GlobalRegion {
+		countryFilter = "&countries=" + region
+	}
+	// Fetch from ScoreSaber
+	if platform == ScoresaberPlatform {
+		id, err := strconv.Atoi(leaderboardId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ScoreSaber leaderboard id %s: %v", leaderboardId, err)
+		}
+		var response scoresaberLeaderboardScores
+		url := fmt.Sprintf("%s/leaderboard/by-id/%s/scores?page=%d%s", scoresaberApiUrl, leaderboardId, page, countryFilter)
+		if err := fetchJson(ctx, url, &response); err != nil {
+			return nil, err
+		}
+		messages := make([]ScoreMessage, 0, len(response.Scores))
+		for _, score := range response.Scores {
+			messages = append(messages, &IncomingMessageWithScore{
+				Score: ScoresaberIncomingScore{
+					Score:       score,
+					Leaderboard: ScoresaberLeaderboard{ID: id},
+				},
+			})
+		}
+		return messages, nil
+	}
+	// Fetch from BeatLeader
+	if platform == BeatleaderPlatform {
+		var response beatleaderLeaderboardScores
+		url := fmt.Sprintf("%s/leaderboard/%s?page=%d&count=%d%s", beatleaderApiUrl, leaderboardId, page, beatleaderPageSize, countryFilter)
+		if err := fetchJson(ctx, url, &response); err != nil {
+			return nil, err
+		}
+		messages := make([]ScoreMessage, 0, len(response.Scores))
+		for i := range response.Scores {
+			// Scores nested within a leaderboard don't repeat the leaderboard id
+			response.Scores[i].LeaderboardID = leaderboardId
+			messages = append(messages, &response.Scores[i])
+		}
+		return messages, nil
+	}
+	return nil, fmt.Errorf("unknown platform %d", platform)
+}
+
+// Perform a GET request and decode the JSON response into the target, giving up if the context is cancelled
+func fetchJson(ctx context.Context, url string, target any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("error requesting %s: %v", url, err)
+	}
+	response, err := restClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error requesting %s: %v", url, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("error requesting %s: %w", url, errRestNotFound)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", response.StatusCode, url)
+	}
+	if err := json.NewDecoder(response.Body).Decode(target); err != nil {
+		return fmt.Errorf("error decoding response from %s: %v", url, err)
+	}
+	return nil
+}
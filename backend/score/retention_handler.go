@@ -0,0 +1,55 @@
+package score
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nonetaken.dev/medalsaber/config"
+	"nonetaken.dev/medalsaber/database"
+)
+
+// How often the scheduler rolls up changes that have aged past the retention period
+const retentionCheckInterval = time.Hour
+
+// Begin rolling up old changes, if enabled with CHANGES_RETENTION (such as "2160h" for 90 days)
+//
+// Changes older than the retention period are replaced with a daily rollup per player and region,
+// holding their net change, gains, losses and the players most responsible. The changes API returns
+// rollups alongside the raw changes still kept. Rollups no longer record each snipe, so rivalries
+// can't be rebuilt once changes have been rolled up, and achievement re-evaluations only see the raw
+// changes.
+func InitialiseRetention(ctx context.Context) {
+	retention := config.GetDuration("CHANGES_RETENTION", 0)
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		rollUpChanges(ctx, retention)
+		ticker := time.NewTicker(retentionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rollUpChanges(ctx, retention)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Roll up the changes of every track that are older than the retention period
+func rollUpChanges(ctx context.Context, retention time.Duration) {
+	before := time.Now().Add(-retention).UnixMilli()
+	for _, track := range standingTracks() {
+		rolledUp, err := database.RollUpChanges(ctx, track, before)
+		if err != nil {
+			log.Printf("error when rolling up changes of track %s: %s\n", track.Name, err)
+			continue
+		}
+		if rolledUp > 0 {
+			log.Printf("rolled up %d changes of track %s", rolledUp, track.Name)
+		}
+	}
+}
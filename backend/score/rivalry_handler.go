@@ -0,0 +1,20 @@
+package score
+
+import (
+	"context"
+	"log"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// Record the change against the rivalry between the player and whoever caused it, if it was a snipe
+//
+// Only medals lost to another player's score count, removals and bans are not snipes
+func handleRivalry(ctx context.Context, change database.Change) {
+	if change.Reason != ChangeReasonScore || change.MedalChange >= 0 || change.ResponsiblePlayerId == change.PlayerId {
+		return
+	}
+	if err := database.RecordSnipe(ctx, change.Platform, change.Region, change.PlayerId, change.ResponsiblePlayerId, -change.MedalChange); err != nil {
+		log.Printf("error when recording snipe on player %s by player %s: %s\n", change.PlayerId, change.ResponsiblePlayerId, err)
+	}
+}
@@ -1,10 +1,14 @@
 package score
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"slices"
+	"strconv"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"nonetaken.dev/medalsaber/achievement"
 	"nonetaken.dev/medalsaber/database"
 )
 
@@ -14,21 +18,49 @@ const (
 	BeatleaderPlatform int = 2
 )
 
-// The medal value of each (indexed) position in the leaderboard
-var MedalValues = map[int]int{
-	0: 10,
-	1: 8,
-	2: 6,
-	3: 5,
-	4: 4,
-	5: 3,
-	6: 2,
-	7: 1,
-	8: 1,
-	9: 1,
-	// We need to specify the 11th position score because scores pushed out of the top 10
-	// will need to know how many medals position 11 is worth, which is 0!
-	10: 0,
+// The region every score counts towards, regardless of the player's country
+const GlobalRegion = database.GlobalRegion
+
+// The reasons a medal change can be recorded for
+const (
+	ChangeReasonScore   = "score"
+	ChangeReasonBan     = "ban"
+	ChangeReasonRemoval = "removal"
+)
+
+// The reasons a score can be archived for
+const (
+	// The player set a better score
+	ArchiveReasonImproved = "improved"
+	// Another player's score pushed it out of the tracked positions
+	ArchiveReasonPushed = "pushed"
+)
+
+// The cause of a set of medal changes, recorded against every change it produces
+type changeCause struct {
+	platform      int
+	leaderboardId string
+	playerId      string
+	scoreId       string
+	timestamp     int64
+	reason        string
+}
+
+// The medal value of each (indexed) position in the leaderboard, kept with the database so its
+// migrations can work out medals too
+var MedalValues = database.MedalValues
+
+// The number of positions on each leaderboard that pay out medals
+const MedalPositions = database.MedalPositions
+
+// The number of scores tracked below the medal positions for each leaderboard and region
+func ReservePositions() int {
+	return database.ReservePositions()
+}
+
+// The total number of positions tracked for each leaderboard and region
+func TrackedPositions() int {
+	return database.TrackedPositions()
 }
 
 // Generic score interface for all platforms
@@ -48,9 +80,23 @@ type ScoreMessage interface {
 	GetModifiers() string
 	GetBadCuts() int
 	GetMissedNotes() int
+	IsFullCombo() bool
+	GetMaxCombo() int
+	GetSongSubName() string
+	GetSongAuthor() string
+	GetMapper() string
+	GetSongHash() string
+	GetGameMode() string
+	GetStars() float64
+	GetCoverImage() string
+	GetPlayerAvatar() string
+	GetPlayerPP() float64
+	GetPlayerRank() int
+	GetPlayerRole() string
+	GetPlayerClan() string
 }
 
-func HandleScore(platform int, message []byte) {
+func HandleScore(ctx context.Context, platform int, message []byte) {
 	var incomingScore ScoreMessage
 	// Handle scores from ScoreSaber
 	if platform == ScoresaberPlatform {
@@ -74,76 +120,129 @@ func HandleScore(platform int, message []byte) {
 	if !incomingScore.IsRanked() {
 		return
 	}
-	// Handle for the region the score was set from and for the world
-	handleForRegion(incomingScore, incomingScore.GetCountry(), true)
-	handleForRegion(incomingScore, "Global", false)
+	// Scores from banned players never count towards medals
+	banned, err := database.IsBanned(ctx, incomingScore.GetPlatform(), incomingScore.GetPlayerId())
+	if err != nil {
+		log.Printf("error when checking if player %s is banned: %s\n", incomingScore.GetPlayerId(), err)
+		return
+	}
+	if banned {
+		return
+	}
+	// Keep the leaderboard's metadata up to date
+	handleLeaderboardMetadata(ctx, incomingScore)
+	// Handle for the region the score was set from and for the world, in every track the score counts towards
+	for _, track := range tracksForScore(ctx, incomingScore) {
+		placedInCountry := handleForRegion(ctx, track, incomingScore, incomingScore.GetCountry())
+		placedGlobally := handleForRegion(ctx, track, incomingScore, GlobalRegion)
+		// Keep the score's details for as long as it holds a place in either region
+		if placedInCountry || placedGlobally {
+			storeScore(ctx, track, incomingScore)
+		}
+	}
+	// Refresh the player's profile now any new player documents exist
+	handleProfileUpdate(ctx, incomingScore)
 }
 
-// Handle the provided score for the given region
+// Handle the provided score for the given region within a track, returning whether it took a place
 //
 // This function will:
 // - award medals to the player who set the score
-// - take medals from players who have been pushed out of the top 10
-// - remove any score pushed from the top 10
+// - take medals from players who have been pushed down or out of the top 10
+// - update the region's standings, dropping any score pushed out of the tracked positions or replaced by an improvement
 // - update medal counts for all affected players
-func handleForRegion(incomingScore ScoreMessage, region string, insertScore bool) {
-	// Get the region the score was set from, is it within top 10?
-	isWithinTopTen, err := database.IsWithinTopTen(incomingScore.GetPlatform(), incomingScore.GetLeaderboardId(), region, incomingScore.GetScore())
+func handleForRegion(ctx context.Context, track *database.Track, incomingScore ScoreMessage, region string) bool {
+	trackedPositions := TrackedPositions()
+	// Get the region the score was set from, is it within the tracked positions?
+	isWithinTopTen, err := database.IsWithinTopTen(ctx, track, incomingScore.GetPlatform(), incomingScore.GetLeaderboardId(), region, incomingScore.GetScore(), trackedPositions)
 	if err != nil {
 		log.Printf("error when checking if a score is within top 10: %s\n", err)
-		return
+		return false
 	}
-	// If not within the top 10, we don't care
+	// If not within the tracked positions, we don't care
 	if !isWithinTopTen {
-		return
+		return false
 	}
-	topTenScores, err := database.GetTopTenScores(incomingScore.GetPlatform(), region, incomingScore.GetLeaderboardId(), 0)
+	standings, err := database.GetStandings(ctx, track, incomingScore.GetPlatform(), region, incomingScore.GetLeaderboardId(), int64(trackedPositions))
 	if err != nil {
 		log.Printf("error when getting top 10 scores: %s\n", err)
-		return
+		return false
 	}
 	medalDeltas := make(map[string]int)
-	position := getScorePositionInTopTen(topTenScores, incomingScore)
-	alreadyPresent := isPlayerWithinTopTen(topTenScores, incomingScore.GetPlayerId())
-	// The player has improved their score, but their position on the leaderboard hasn't changed
-	// Or, the score is not in the top 10 at all
-	if alreadyPresent == position || position == -1 {
+	positionDeltas := make(map[string]map[int]int)
+	position := getScorePositionInTopTen(standings, incomingScore.GetScore(), trackedPositions)
+	alreadyPresent := isPlayerWithinTopTen(standings, incomingScore.GetPlayerId())
+	// The score is not within the tracked positions at all, or is not an improvement
+	if position == -1 || (alreadyPresent != -1 && position > alreadyPresent) {
 		log.Printf("score from player %s (platform: %d, id: %s, region: %s) on leaderboard %s (difficulty: %s) was not improved or not within region top 10",
 			incomingScore.GetPlayerName(), incomingScore.GetPlatform(), incomingScore.GetPlayerId(), region, incomingScore.GetLeaderboardName(), incomingScore.GetDifficulty())
-		return
+		return false
 	}
-	// Calculate medal deltas for all affected players
-	calculateMedalDeltas(medalDeltas, topTenScores, incomingScore, position, alreadyPresent)
-	// Handle score removal if we're at capacity and adding a new player
-	if alreadyPresent == -1 && len(topTenScores) >= 10 {
-		// Remove the 10th place score (index 9) since we're adding a new player
-		removedScore := topTenScores[9]
-		database.DeleteDocument(database.Collections.Scores, bson.M{
-			"scoreId":  removedScore.ScoreId,
-			"platform": removedScore.Platform,
-		})
-	}
-	newScore := convertIntoDatabaseScore(incomingScore)
-	// Insert the new score into the database if applicable
-	if insertScore {
-		err = database.InsertDocument(database.Collections.Scores, newScore)
-		if err != nil {
-			log.Printf("error when inserting new score: %s\n", err)
+	// Calculate medal and position deltas for all affected players
+	calculateMedalDeltas(medalDeltas, standings, incomingScore.GetPlayerId(), position, alreadyPresent)
+	calculatePositionDeltas(positionDeltas, standings, incomingScore.GetPlayerId(), position, alreadyPresent)
+	// The last tracked score is pushed out if we're at capacity and adding a new player
+	var pushedOut *database.Standing
+	if alreadyPresent == -1 && len(standings) >= trackedPositions {
+		pushedOut = &standings[trackedPositions-1]
+		archiveScore(ctx, track, *pushedOut, ArchiveReasonPushed, incomingScore)
+	}
+	// The player's previous score has been replaced by their improvement
+	if alreadyPresent != -1 {
+		archiveScore(ctx, track, standings[alreadyPresent], ArchiveReasonImproved, incomingScore)
+	}
+	// Save the region's new standings
+	newStandings := placeStanding(standings, database.Standing{
+		Platform:      incomingScore.GetPlatform(),
+		LeaderboardId: incomingScore.GetLeaderboardId(),
+		Region:        region,
+		ScoreId:       incomingScore.GetScoreId(),
+		PlayerId:      incomingScore.GetPlayerId(),
+		Score:         incomingScore.GetScore(),
+		Timestamp:     incomingScore.GetTimestamp(),
+	}, position, alreadyPresent, trackedPositions)
+	if err = database.SetStandings(ctx, track, incomingScore.GetPlatform(), incomingScore.GetLeaderboardId(), region, newStandings); err != nil {
+		log.Printf("error when saving standings: %s\n", err)
+		return false
+	}
+	// The pushed out score's details are no longer needed, unless it still holds a place in another region
+	if pushedOut != nil {
+		if err = database.DeleteUntrackedScore(ctx, track, pushedOut.Platform, pushedOut.ScoreId); err != nil {
+			log.Printf("error when deleting score: %s\n", err)
 		}
 	}
 	// Handle the medal changes for all players
-	handleMedalChanges(medalDeltas, incomingScore, region)
-	// Check if the player's username has changed
-	handlePotentialNameChange(newScore.GetPlayer(region), incomingScore)
-	log.Printf("the score from player %s (platform: %d, id: %s, region: %s) on leaderboard %s (difficulty: %s) has been handled! the player earned position %d",
-		incomingScore.GetPlayerName(), incomingScore.GetPlatform(), incomingScore.GetPlayerId(), region, incomingScore.GetLeaderboardName(), incomingScore.GetDifficulty(), position)
+	handleMedalChanges(ctx, track, medalDeltas, positionDeltas, causeFromScore(incomingScore), region)
+	log.Printf("the score from player %s (platform: %d, id: %s, region: %s, track: %s) on leaderboard %s (difficulty: %s) has been handled! the player earned position %d",
+		incomingScore.GetPlayerName(), incomingScore.GetPlatform(), incomingScore.GetPlayerId(), region, track.Name, incomingScore.GetLeaderboardName(), incomingScore.GetDifficulty(), position)
+	return true
+}
+
+// Store the details of a score that has taken a place, replacing the player's previous score on the leaderboard
+//
+// The previous score is kept if it still holds a place in another region, such as a country the player has left
+func storeScore(ctx context.Context, track *database.Track, incomingScore ScoreMessage) {
+	previousScores, err := database.GetLeaderboardScores(ctx, track, incomingScore.GetPlatform(), incomingScore.GetLeaderboardId(), incomingScore.GetPlayerId())
+	if err != nil {
+		log.Printf("error when getting previous scores: %s\n", err)
+		return
+	}
+	if err = database.InsertScore(ctx, track, convertIntoDatabaseScore(incomingScore)); err != nil {
+		log.Printf("error when inserting new score: %s\n", err)
+		return
+	}
+	for _, previousScore := range previousScores {
+		if err = database.DeleteUntrackedScore(ctx, track, previousScore.Platform, previousScore.ScoreId); err != nil {
+			log.Printf("error when deleting previous score: %s\n", err)
+		}
+	}
 }
 
 // --- various single use helper functions to help organise code
 
 // Return the position the player is in within the top 10 scores
 // Will return -1 if the player is not already within the top 10
-func isPlayerWithinTopTen(topTenScores []database.Score, playerId string) int {
+func isPlayerWithinTopTen(topTenScores []database.Standing, playerId string) int {
 	for i, score := range topTenScores {
 		if score.PlayerId == playerId {
 			return i
@@ -152,19 +251,43 @@ func isPlayerWithinTopTen(topTenScores []database.Score, playerId string) int {
 	return -1
 }
 
-// Return what position within the top 10 the incoming score would be
-func getScorePositionInTopTen(topTenScores []database.Score, incomingScore ScoreMessage) int {
-	if len(topTenScores) == 0 {
-		return 0
-	}
+// Return what position within the tracked scores the incoming score would be
+// Will return -1 if the score doesn't beat any score and there is no room left
+func getScorePositionInTopTen(topTenScores []database.Standing, incomingScore int, trackedPositions int) int {
 	for i, score := range topTenScores {
-		if incomingScore.GetScore() > score.Score {
+		if incomingScore > score.Score {
 			return i
 		}
 	}
+	// The score takes the next free position if the leaderboard isn't full
+	if len(topTenScores) < trackedPositions {
+		return len(topTenScores)
+	}
 	return -1
 }
 
+// Return a region's standings once the new standing takes the position, replacing the player's
+// previous standing and dropping anything past the tracked positions
+func placeStanding(standings []database.Standing, standing database.Standing, position int, alreadyPresent int, trackedPositions int) []database.Standing {
+	placed := make([]database.Standing, 0, len(standings)+1)
+	for i, existing := range standings {
+		// An improvement never moves a player down, so removing their previous standing can't shift the position
+		if i != alreadyPresent {
+			placed = append(placed, existing)
+		}
+	}
+	placed = slices.Insert(placed, position, standing)
+	return numberStandings(placed[:min(len(placed), trackedPositions)])
+}
+
+// Number the standings in order, starting from first place
+func numberStandings(standings []database.Standing) []database.Standing {
+	for i := range standings {
+		standings[i].Position = i + 1
+	}
+	return standings
+}
+
 // Convert the incoming score into a database score
 func convertIntoDatabaseScore(incomingScore ScoreMessage) database.Score {
 	return database.Score{
@@ -178,69 +301,235 @@ func convertIntoDatabaseScore(incomingScore ScoreMessage) database.Score {
 		Modifiers:     incomingScore.GetModifiers(),
 		BadCuts:       incomingScore.GetBadCuts(),
 		MissedNotes:   incomingScore.GetMissedNotes(),
+		FullCombo:     incomingScore.IsFullCombo(),
+		MaxCombo:      incomingScore.GetMaxCombo(),
+	}
+}
+
+// Convert the incoming score into the metadata for its leaderboard
+func convertIntoDatabaseLeaderboard(incomingScore ScoreMessage) database.Leaderboard {
+	return database.Leaderboard{
+		Platform:      incomingScore.GetPlatform(),
+		LeaderboardId: incomingScore.GetLeaderboardId(),
+		SongName:      incomingScore.GetLeaderboardName(),
+		SongSubName:   incomingScore.GetSongSubName(),
+		SongAuthor:    incomingScore.GetSongAuthor(),
+		Mapper:        incomingScore.GetMapper(),
+		SongHash:      incomingScore.GetSongHash(),
+		Difficulty:    incomingScore.GetDifficulty(),
+		GameMode:      incomingScore.GetGameMode(),
+		Stars:         incomingScore.GetStars(),
+		CoverImage:    incomingScore.GetCoverImage(),
+		MaxScore:      incomingScore.GetMaxScore(),
 	}
 }
 
 // Calculate medal deltas for all affected players
-func calculateMedalDeltas(medalDeltas map[string]int, topTenScores []database.Score, incomingScore ScoreMessage, position int, alreadyPresent int) {
-	// Calculate how many medals each player moved down will lose
-	for i := position + 1; i < len(topTenScores); i++ {
-		// If the player being checked is the player who set the score, we need to remove their medals
-		// entirely. They will be awarded new medals for their improved score.
-		if topTenScores[i].PlayerId == incomingScore.GetPlayerId() {
-			medalDeltas[topTenScores[i].PlayerId] = -MedalValues[alreadyPresent]
-			continue
-		}
-		medalDeltas[topTenScores[i].PlayerId] = MedalValues[i-1] - MedalValues[i]
+//
+// Positions past the top 10 are worth no medals, so players moving within the reserve are unaffected
+func calculateMedalDeltas(medalDeltas map[string]int, topTenScores []database.Standing, playerId string, position int, alreadyPresent int) {
+	// Everyone between the new position and the player's old position (or the end) moves down one place
+	lastMoved := len(topTenScores)
+	if alreadyPresent != -1 {
+		lastMoved = alreadyPresent
+	}
+	for i := position; i < lastMoved; i++ {
+		medalDeltas[topTenScores[i].PlayerId] += MedalValues[i+1] - MedalValues[i]
+	}
+	// The player who set the score gives up the medals for their old position, if they had one
+	if alreadyPresent != -1 {
+		medalDeltas[playerId] -= MedalValues[alreadyPresent]
 	}
 	// Next, add the medals for the player who set the score
-	medalDeltas[incomingScore.GetPlayerId()] += MedalValues[position]
+	medalDeltas[playerId] += MedalValues[position]
 }
 
-// Handle medal changes for all players in the map
-func handleMedalChanges(medalDeltas map[string]int, incomingScore ScoreMessage, region string) {
-	// Apply the medal deltas to all the players in the map
-	for playerId, delta := range medalDeltas {
-		player, err := database.GetPlayer(incomingScore.GetPlatform(), region, playerId, incomingScore.GetPlayerName(), true)
-		if err != nil {
-			log.Printf("error when getting player: %s\n", err)
+// Calculate how each affected player's position histogram changes
+func calculatePositionDeltas(positionDeltas map[string]map[int]int, topTenScores []database.Standing, playerId string, position int, alreadyPresent int) {
+	// Everyone between the new position and the player's old position (or the end) moves down one place
+	lastMoved := len(topTenScores)
+	if alreadyPresent != -1 {
+		lastMoved = alreadyPresent
+	}
+	for i := position; i < lastMoved; i++ {
+		movePosition(positionDeltas, topTenScores[i].PlayerId, i, i+1)
+	}
+	// The player who set the score moves from their old position, if they had one
+	movePosition(positionDeltas, playerId, alreadyPresent, position)
+}
+
+// Record a player moving between two positions in their position histogram
+//
+// Use -1 when the player had no position, or no longer has one. Positions outside the
+// top 10 aren't counted in the histogram.
+func movePosition(positionDeltas map[string]map[int]int, playerId string, from int, to int) {
+	if from == to {
+		return
+	}
+	if positionDeltas[playerId] == nil {
+		positionDeltas[playerId] = make(map[int]int)
+	}
+	if from >= 0 && from < MedalPositions {
+		positionDeltas[playerId][from]--
+	}
+	if to >= 0 && to < MedalPositions {
+		positionDeltas[playerId][to]++
+	}
+}
+
+// Build the change cause for a newly set score
+func causeFromScore(incomingScore ScoreMessage) changeCause {
+	return changeCause{
+		platform:      incomingScore.GetPlatform(),
+		leaderboardId: incomingScore.GetLeaderboardId(),
+		playerId:      incomingScore.GetPlayerId(),
+		scoreId:       incomingScore.GetScoreId(),
+		timestamp:     incomingScore.GetTimestamp(),
+		reason:        ChangeReasonScore,
+	}
+}
+
+// Handle medal and position changes for all players in the map
+func handleMedalChanges(ctx context.Context, track *database.Track, medalDeltas map[string]int, positionDeltas map[string]map[int]int, cause changeCause, region string) {
+	// Gather every player affected by either kind of change
+	playerIds := make(map[string]bool)
+	for playerId := range medalDeltas {
+		playerIds[playerId] = true
+	}
+	for playerId := range positionDeltas {
+		playerIds[playerId] = true
+	}
+	// Gather the deltas to apply, players moving within the reserve don't gain or lose anything
+	var deltas []database.MedalDelta
+	for playerId := range playerIds {
+		positionUpdate := make(map[string]int)
+		for position, count := range positionDeltas[playerId] {
+			if count != 0 {
+				positionUpdate[strconv.Itoa(position+1)] = count
+			}
+		}
+		if medalDeltas[playerId] == 0 && len(positionUpdate) == 0 {
+			continue
+		}
+		deltas = append(deltas, database.MedalDelta{PlayerId: playerId, Medals: medalDeltas[playerId], Positions: positionUpdate})
+	}
+	if len(deltas) == 0 {
+		return
+	}
+	// Update the medal counts and position histograms of every player at once
+	players, err := database.ApplyMedalDeltas(ctx, track, cause.platform, region, deltas)
+	// Deltas applied before an error still moved medals, so their changes are recorded, though the
+	// players weren't read back to judge their achievements and ranks by
+	partial := err != nil
+	if partial {
+		log.Printf("error when updating players, %d of %d applied: %s\n", len(players), len(deltas), err)
+	}
+	var changes []database.Change
+	for i := range players {
+		player := &players[i]
+		delta := deltas[i].Medals
+		// Keep track of first places for the clan standings
+		if track == database.Lifetime {
+			handleMapLeader(ctx, player.PlayerId, positionDeltas[player.PlayerId], cause, region)
+		}
+		change := database.Change{
+			Platform:                 cause.platform,
+			PlayerId:                 player.PlayerId,
+			Region:                   region,
+			Timestamp:                cause.timestamp,
+			MedalChange:              delta,
+			ResponsibleLeaderboardId: cause.leaderboardId,
+			ResponsiblePlayerId:      cause.playerId,
+			ResponsibleScoreId:       cause.scoreId,
+			Reason:                   cause.reason,
+		}
+		// Only medal changes are recorded, moving between positions worth the same is not
+		if delta == 0 {
 			continue
 		}
-		// Update the medal counts
-		player.Medals += delta
-		if err = database.UpdateDocument(
-			database.Collections.Players,
-			bson.M{"playerId": playerId, "platform": incomingScore.GetPlatform()},
-			bson.M{"$set": bson.M{"medals": player.Medals}}); err != nil {
-			log.Printf("error when updating player: %s\n", err)
-		}
-		// Record the changes
-		if err = database.InsertDocument(
-			database.Collections.Changes,
-			database.Change{
-				Platform:                 incomingScore.GetPlatform(),
-				PlayerId:                 playerId,
-				Region:                   region,
-				Timestamp:                incomingScore.GetTimestamp(),
-				MedalChange:              delta,
-				ResponsibleLeaderboardId: incomingScore.GetLeaderboardId(),
-				ResponsiblePlayerId:      incomingScore.GetPlayerId(),
-				ResponsibleScoreId:       incomingScore.GetScoreId(),
-			}); err != nil {
-			log.Printf("error when inserting change: %s\n", err)
-		}
-	}
-}
-
-// Check whether the stored username for the player is different than the incoming score
-func handlePotentialNameChange(player *database.Player, incomingScore ScoreMessage) {
-	if player.Username == "" || player.Username != incomingScore.GetPlayerName() {
-		player.Username = incomingScore.GetPlayerName()
-		if err := database.UpdateDocument(
-			database.Collections.Players,
-			bson.M{"playerId": player.PlayerId, "platform": incomingScore.GetPlatform()},
-			bson.M{"$set": bson.M{"username": player.Username}}); err != nil {
-			log.Printf("error when updating player: %s\n", err)
+		// Award any achievements earned, these are only given for lifetime standings and are stored with
+		// the change that earned them
+		if track == database.Lifetime && !partial {
+			change.Achievements = achievement.Evaluate(ctx, player, &change)
+		}
+		changes = append(changes, change)
+	}
+	// Record the changes
+	if err = database.InsertChanges(ctx, track, changes); err != nil {
+		log.Printf("error when inserting changes: %s\n", err)
+	}
+	// Keep the lifetime rivalries and ranks up to date
+	if track == database.Lifetime {
+		for _, change := range changes {
+			handleRivalry(ctx, change)
+		}
+		if !partial {
+			handleRankChanges(ctx, cause.platform, region, players, deltas, cause)
 		}
 	}
 }
+
+// Archive a score that is leaving a region's tracked positions, along with the position and medals it held
+//
+// Only the lifetime track keeps a history, other tracks hold the same scores
+func archiveScore(ctx context.Context, track *database.Track, standing database.Standing, reason string, incomingScore ScoreMessage) {
+	if track != database.Lifetime {
+		return
+	}
+	archivedScore, err := database.GetScore(ctx, track, standing.Platform, standing.ScoreId)
+	if err != nil {
+		log.Printf("error when getting score %s to archive: %s\n", standing.ScoreId, err)
+		return
+	}
+	if err = database.InsertDocument(ctx, database.Collections.ScoreHistory, database.ArchivedScore{
+		Score:             archivedScore,
+		Region:            standing.Region,
+		Position:          standing.Position,
+		Medals:            MedalValues[standing.Position-1],
+		ArchivedAt:        incomingScore.GetTimestamp(),
+		Reason:            reason,
+		ReplacedByScoreId: incomingScore.GetScoreId(),
+	}); err != nil {
+		log.Printf("error when archiving score %s: %s\n", archivedScore.ScoreId, err)
+	}
+}
+
+// Create or refresh the stored metadata for the score's leaderboard
+func handleLeaderboardMetadata(ctx context.Context, incomingScore ScoreMessage) {
+	if err := database.UpsertDocument(ctx,
+		database.Collections.Leaderboards,
+		bson.M{"platform": incomingScore.GetPlatform(), "leaderboardId": incomingScore.GetLeaderboardId()},
+		bson.M{"$set": convertIntoDatabaseLeaderboard(incomingScore)}); err != nil {
+		log.Printf("error when updating leaderboard %s: %s\n", incomingScore.GetLeaderboardId(), err)
+	}
+}
+
+// Refresh the stored profile of the player who set the score in every track they're tracked in
+func handleProfileUpdate(ctx context.Context, incomingScore ScoreMessage) {
+	for _, track := range standingTracks() {
+		handleProfileUpdateForTrack(ctx, track, incomingScore)
+	}
+}
+
+// Refresh the stored profile of the player who set the score in every region of the track
+//
+// Username and country changes are also appended to the player's history
+func handleProfileUpdateForTrack(ctx context.Context, track *database.Track, incomingScore ScoreMessage) {
+	profile := database.PlayerProfile{
+		Username:  incomingScore.GetPlayerName(),
+		Avatar:    incomingScore.GetPlayerAvatar(),
+		Country:   incomingScore.GetCountry(),
+		PP:        incomingScore.GetPlayerPP(),
+		Rank:      incomingScore.GetPlayerRank(),
+		Role:      incomingScore.GetPlayerRole(),
+		Timestamp: incomingScore.GetTimestamp(),
+	}
+	// Only BeatLeader has clans, and players can leave them, so always take the latest
+	if incomingScore.GetPlatform() == BeatleaderPlatform {
+		clan := incomingScore.GetPlayerClan()
+		profile.Clan = &clan
+	}
+	if err := database.UpdatePlayerProfile(ctx, track, incomingScore.GetPlatform(), incomingScore.GetPlayerId(), profile); err != nil {
+		log.Printf("error when updating player: %s\n", err)
+	}
+}
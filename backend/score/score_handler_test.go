@@ -0,0 +1,66 @@
+package score
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// Return standings for the players, in order with scores falling by 10
+func standingsOf(playerIds string) []database.Standing {
+	var standings []database.Standing
+	for i, playerId := range strings.Split(playerIds, ",") {
+		standings = append(standings, database.Standing{PlayerId: playerId, Score: 1000 - i*10, Position: i + 1})
+	}
+	return standings
+}
+
+func TestPlaceStanding(t *testing.T) {
+	tests := []struct {
+		name      string
+		standings string
+		score     int
+		tracked   int
+		// The players in order once placed, empty if the score takes no position
+		placed string
+		deltas map[string]int
+	}{
+		{name: "new first place", standings: "a,b,c", score: 1001, tracked: 5, placed: "p,a,b,c", deltas: map[string]int{"a": -2, "b": -2, "c": -1, "p": 10}},
+		{name: "ties go after the earlier score", standings: "a,b,c", score: 990, tracked: 5, placed: "a,b,p,c", deltas: map[string]int{"c": -1, "p": 6}},
+		{name: "improving replaces the previous standing", standings: "a,b,p,c", score: 1005, tracked: 5, placed: "p,a,b,c", deltas: map[string]int{"a": -2, "b": -2, "p": 4}},
+		{name: "full region drops the last", standings: "a,b,c", score: 985, tracked: 3, placed: "a,b,p", deltas: map[string]int{"c": -1, "p": 6}},
+		{name: "full region keeps the last on a tie", standings: "a,b,c", score: 980, tracked: 3},
+		{name: "pushing the last medal into the reserve", standings: "a,b,c,d,e,f,g,h,i,j,k", score: 915, tracked: 12, placed: "a,b,c,d,e,f,g,h,i,p,j,k", deltas: map[string]int{"j": -1, "k": 0, "p": 1}},
+		{name: "moving within the reserve", standings: "a,b,c,d,e,f,g,h,i,j,k,l,p", score: 895, tracked: 13, placed: "a,b,c,d,e,f,g,h,i,j,k,p,l", deltas: map[string]int{"l": 0, "p": 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			standings := standingsOf(test.standings)
+			position := getScorePositionInTopTen(standings, test.score, test.tracked)
+			if position == -1 {
+				if test.placed != "" {
+					t.Fatalf("getScorePositionInTopTen found no position, expected %s", test.placed)
+				}
+				return
+			}
+			alreadyPresent := isPlayerWithinTopTen(standings, "p")
+			deltas := make(map[string]int)
+			calculateMedalDeltas(deltas, standings, "p", position, alreadyPresent)
+			if !maps.Equal(deltas, test.deltas) {
+				t.Errorf("calculateMedalDeltas returned %v, expected %v", deltas, test.deltas)
+			}
+			var placed []string
+			for i, standing := range placeStanding(standings, database.Standing{PlayerId: "p", Score: test.score}, position, alreadyPresent, test.tracked) {
+				placed = append(placed, standing.PlayerId)
+				if standing.Position != i+1 {
+					t.Errorf("player %s holds position %d, expected %d", standing.PlayerId, standing.Position, i+1)
+				}
+			}
+			if strings.Join(placed, ",") != test.placed {
+				t.Errorf("placeStanding returned %s, expected %s", strings.Join(placed, ","), test.placed)
+			}
+		})
+	}
+}
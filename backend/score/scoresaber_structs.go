@@ -3,9 +3,19 @@ package score
 import (
 	"log"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// ScoreSaber identifies difficulties by number, map them to the names BeatLeader uses
+var scoresaberDifficultyNames = map[int]string{
+	1: "Easy",
+	3: "Normal",
+	5: "Hard",
+	7: "Expert",
+	9: "ExpertPlus",
+}
+
 /*
  * Structs for the ScoreSaber API
  */
@@ -28,6 +38,9 @@ func (message *IncomingMessageWithScore) GetLeaderboardName() string {
 	return message.Score.Leaderboard.SongName
 }
 func (message *IncomingMessageWithScore) GetDifficulty() string {
+	if name, ok := scoresaberDifficultyNames[message.Score.Leaderboard.Difficulty.Difficulty]; ok {
+		return name
+	}
 	return message.Score.Leaderboard.Difficulty.DifficultyRaw
 }
 func (message *IncomingMessageWithScore) GetCountry() string {
@@ -66,6 +79,53 @@ func (message *IncomingMessageWithScore) GetBadCuts() int {
 func (message *IncomingMessageWithScore) GetMissedNotes() int {
 	return message.Score.Score.MissedNotes
 }
+func (message *IncomingMessageWithScore) IsFullCombo() bool {
+	return message.Score.Score.FullCombo
+}
+func (message *IncomingMessageWithScore) GetMaxCombo() int {
+	return message.Score.Score.MaxCombo
+}
+func (message *IncomingMessageWithScore) GetSongSubName() string {
+	return message.Score.Leaderboard.SongSubName
+}
+func (message *IncomingMessageWithScore) GetSongAuthor() string {
+	return message.Score.Leaderboard.SongAuthorName
+}
+func (message *IncomingMessageWithScore) GetMapper() string {
+	return message.Score.Leaderboard.LevelAuthorName
+}
+func (message *IncomingMessageWithScore) GetSongHash() string {
+	return message.Score.Leaderboard.SongHash
+}
+func (message *IncomingMessageWithScore) GetGameMode() string {
+	// ScoreSaber prefixes modes with "Solo", e.g. "SoloStandard"
+	return strings.TrimPrefix(message.Score.Leaderboard.Difficulty.GameMode, "Solo")
+}
+func (message *IncomingMessageWithScore) GetStars() float64 {
+	return message.Score.Leaderboard.Stars
+}
+func (message *IncomingMessageWithScore) GetCoverImage() string {
+	return message.Score.Leaderboard.CoverImage
+}
+func (message *IncomingMessageWithScore) GetPlayerAvatar() string {
+	return message.Score.Score.LeaderboardPlayerInfo.ProfilePicture
+}
+func (message *IncomingMessageWithScore) GetPlayerPP() float64 {
+	// ScoreSaber doesn't send the player's performance points with their scores
+	return 0
+}
+func (message *IncomingMessageWithScore) GetPlayerRank() int {
+	// ScoreSaber doesn't send the player's rank with their scores
+	return 0
+}
+func (message *IncomingMessageWithScore) GetPlayerRole() string {
+	return message.Score.Score.LeaderboardPlayerInfo.Role
+}
+
+// ScoreSaber has no clans
+func (message *IncomingMessageWithScore) GetPlayerClan() string {
+	return ""
+}
 
 type ScoresaberPlayer struct {
 	ID                string               `json:"id"`
@@ -0,0 +1,159 @@
+package score
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"nonetaken.dev/medalsaber/database"
+)
+
+// The lengths a season can be configured to run for with SEASON_LENGTH
+const (
+	SeasonLengthMonthly   = "monthly"
+	SeasonLengthQuarterly = "quarterly"
+)
+
+// How often the scheduler checks whether the season needs to roll over
+const seasonCheckInterval = time.Minute
+
+// The season currently in progress, nil if seasons are disabled
+var activeSeason *database.Season
+var activeSeasonMutex sync.RWMutex
+
+// Return the season currently in progress, or nil if seasons are disabled
+func currentSeason() *database.Season {
+	activeSeasonMutex.RLock()
+	defer activeSeasonMutex.RUnlock()
+	return activeSeason
+}
+
+// Begin running seasons, if enabled with SEASON_LENGTH
+//
+// Standings for each season start from nothing and only count scores set within the season.
+// The scheduler archives the final standings of each season once it ends and starts the next,
+// until ctx is cancelled.
+func InitialiseSeasons(ctx context.Context) {
+	length := os.Getenv("SEASON_LENGTH")
+	if length == "" {
+		return
+	}
+	if !database.MongoEnabled() {
+		log.Println("seasons are kept in MongoDB, set MONGO_URI to enable them. seasons are disabled")
+		return
+	}
+	if length != SeasonLengthMonthly && length != SeasonLengthQuarterly {
+		log.Printf("invalid SEASON_LENGTH %q, use %s or %s. seasons are disabled\n", length, SeasonLengthMonthly, SeasonLengthQuarterly)
+		return
+	}
+	rolloverSeasons(ctx, length)
+	go func() {
+		ticker := time.NewTicker(seasonCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rolloverSeasons(ctx, length)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Archive any season that has ended and make sure the current season exists
+func rolloverSeasons(ctx context.Context, length string) {
+	now := time.Now().UTC()
+	endedSeasons, err := database.GetUnarchivedSeasons(ctx, now.UnixMilli())
+	if err != nil {
+		log.Printf("error when getting ended seasons: %s\n", err)
+		return
+	}
+	for _, season := range endedSeasons {
+		archiveSeason(ctx, season)
+	}
+	// Create the season for the current time if it doesn't exist yet
+	season := seasonFor(now, length)
+	storedSeason, err := database.GetSeason(ctx, season.SeasonId)
+	if err == mongo.ErrNoDocuments {
+		if err = database.InsertDocument(ctx, database.Collections.Seasons, season); err != nil {
+			log.Printf("error when creating season %s: %s\n", season.SeasonId, err)
+			return
+		}
+		log.Printf("season %s has begun", season.SeasonId)
+		storedSeason = season
+	} else if err != nil {
+		log.Printf("error when getting season %s: %s\n", season.SeasonId, err)
+		return
+	}
+	activeSeasonMutex.Lock()
+	activeSeason = &storedSeason
+	activeSeasonMutex.Unlock()
+}
+
+// Build the season of the configured length that contains the provided time
+func seasonFor(now time.Time, length string) database.Season {
+	var start, end time.Time
+	var seasonId string
+	if length == SeasonLengthQuarterly {
+		quarter := (int(now.Month()) - 1) / 3
+		start = time.Date(now.Year(), time.Month(quarter*3+1), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 3, 0)
+		seasonId = fmt.Sprintf("%d-Q%d", now.Year(), quarter+1)
+	} else {
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 1, 0)
+		seasonId = start.Format("2006-01")
+	}
+	return database.Season{
+		SeasonId: seasonId,
+		Start:    start.UnixMilli(),
+		End:      end.UnixMilli(),
+		Archived: false,
+	}
+}
+
+// Freeze the final standings of a season into the archive
+func archiveSeason(ctx context.Context, season database.Season) {
+	players, err := database.GetTrackStandings(ctx, season.GetTrack())
+	if err != nil {
+		log.Printf("error when getting standings for season %s: %s\n", season.SeasonId, err)
+		return
+	}
+	// Rank players within each platform and region
+	ranks := database.RankStandings(players)
+	standings := make([]any, 0, len(players))
+	for i, player := range players {
+		standings = append(standings, database.SeasonStanding{
+			SeasonId:  season.SeasonId,
+			Platform:  player.Platform,
+			Region:    player.Region,
+			PlayerId:  player.PlayerId,
+			Username:  player.Username,
+			Rank:      ranks[i],
+			Medals:    player.Medals,
+			Positions: player.Positions,
+		})
+	}
+	// Clear out anything left behind by a previous attempt before writing the archive
+	if err = database.DeleteManyDocuments(ctx, database.Collections.SeasonStandings, bson.M{"seasonId": season.SeasonId}); err != nil {
+		log.Printf("error when clearing standings for season %s: %s\n", season.SeasonId, err)
+		return
+	}
+	if len(standings) > 0 {
+		if err = database.InsertManyDocuments(ctx, database.Collections.SeasonStandings, standings); err != nil {
+			log.Printf("error when archiving standings for season %s: %s\n", season.SeasonId, err)
+			return
+		}
+	}
+	if err = database.UpdateDocument(ctx, database.Collections.Seasons, bson.M{"seasonId": season.SeasonId}, bson.M{"$set": bson.M{"archived": true}}); err != nil {
+		log.Printf("error when archiving season %s: %s\n", season.SeasonId, err)
+		return
+	}
+	log.Printf("season %s has ended, %d standings archived", season.SeasonId, len(standings))
+}
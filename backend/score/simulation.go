@@ -0,0 +1,45 @@
+package score
+
+import (
+	"context"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// The outcome of a hypothetical score, as if it had been set right now
+type Simulation struct {
+	// The position the score would take, 1 for first place, or 0 if it wouldn't place or isn't an improvement
+	Position int
+	// The position the player currently holds, or 0 if they aren't tracked
+	PreviousPosition int
+	// The change in medals for every affected player
+	MedalDeltas map[string]int
+}
+
+// Simulate a player setting a score on a leaderboard, without persisting anything
+//
+// This runs the same position and medal calculations as a real score against the current standings
+func SimulateScore(ctx context.Context, track *database.Track, platform int, leaderboardId string, region string, playerId string, score int) (Simulation, error) {
+	trackedPositions := TrackedPositions()
+	standings, err := database.GetStandings(ctx, track, platform, region, leaderboardId, int64(trackedPositions))
+	if err != nil {
+		return Simulation{}, err
+	}
+	simulation := Simulation{MedalDeltas: make(map[string]int)}
+	position := getScorePositionInTopTen(standings, score, trackedPositions)
+	alreadyPresent := isPlayerWithinTopTen(standings, playerId)
+	simulation.PreviousPosition = alreadyPresent + 1
+	// The score wouldn't be tracked, or wouldn't improve on the player's current score
+	if position == -1 || (alreadyPresent != -1 && position > alreadyPresent) {
+		return simulation, nil
+	}
+	simulation.Position = position + 1
+	calculateMedalDeltas(simulation.MedalDeltas, standings, playerId, position, alreadyPresent)
+	// Leave out anyone whose medals wouldn't change, such as players moving within the reserve
+	for affectedId, delta := range simulation.MedalDeltas {
+		if delta == 0 {
+			delete(simulation.MedalDeltas, affectedId)
+		}
+	}
+	return simulation, nil
+}
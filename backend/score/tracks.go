@@ -0,0 +1,168 @@
+package score
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"nonetaken.dev/medalsaber/database"
+)
+
+// A set of standings the engine maintains, along with the rule for which scores count towards it
+type scoreTrack struct {
+	track   *database.Track
+	accepts func(ctx context.Context, incomingScore ScoreMessage) bool
+}
+
+// The names of the derived tracks that can be enabled
+const (
+	FullComboTrack = "fullcombo"
+	NoMissTrack    = "nomiss"
+)
+
+// The derived tracks, each only accepting plays that meet its rule
+var derivedTracks = map[string]func(ctx context.Context, incomingScore ScoreMessage) bool{
+	// Plays with no missed notes, bad cuts or bomb hits, as judged by the platform
+	FullComboTrack: func(ctx context.Context, incomingScore ScoreMessage) bool {
+		return incomingScore.IsFullCombo()
+	},
+	// Plays with no missed notes, bad cuts are allowed
+	NoMissTrack: func(ctx context.Context, incomingScore ScoreMessage) bool {
+		return incomingScore.GetMissedNotes() == 0
+	},
+}
+
+// Return the names of the derived tracks enabled with DERIVED_TRACKS, a comma separated list
+func enabledDerivedTracks() []string {
+	var names []string
+	for _, name := range configuredList("DERIVED_TRACKS") {
+		if _, ok := derivedTracks[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// The prefix of the tracks kept for each game mode enabled with MODE_TRACKS
+const modeTrackPrefix = "mode_"
+
+// Return the name of the track kept for a game mode, such as mode_onesaber for OneSaber
+func ModeTrackName(mode string) string {
+	return modeTrackPrefix + strings.ToLower(mode)
+}
+
+// Return whether the score counts towards the lifetime and season medals
+//
+// Every game mode counts unless LIFETIME_MODES limits them, such as to only Standard
+func countsTowardsMainPool(ctx context.Context, incomingScore ScoreMessage) bool {
+	modes := configuredList("LIFETIME_MODES")
+	if len(modes) == 0 {
+		return true
+	}
+	gameMode := gameModeOf(ctx, incomingScore)
+	for _, mode := range modes {
+		if strings.EqualFold(gameMode, mode) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the game mode the score was set in
+//
+// Scores fetched from the REST APIs don't carry their leaderboard's difficulty, so fall back to
+// the stored leaderboard metadata
+func gameModeOf(ctx context.Context, incomingScore ScoreMessage) string {
+	if mode := incomingScore.GetGameMode(); mode != "" {
+		return mode
+	}
+	leaderboard, err := database.GetLeaderboard(ctx, incomingScore.GetPlatform(), incomingScore.GetLeaderboardId())
+	if err != nil {
+		return ""
+	}
+	return leaderboard.GameMode
+}
+
+// Return the values of a comma separated environment variable
+func configuredList(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Return every track the engine currently maintains standings for
+func activeTracks() []scoreTrack {
+	tracks := []scoreTrack{{
+		track:   database.Lifetime,
+		accepts: countsTowardsMainPool,
+	}}
+	// Only scores set within the current season count towards it
+	if season := currentSeason(); season != nil {
+		tracks = append(tracks, scoreTrack{
+			track: season.GetTrack(),
+			accepts: func(ctx context.Context, incomingScore ScoreMessage) bool {
+				return season.Contains(incomingScore.GetTimestamp()) && countsTowardsMainPool(ctx, incomingScore)
+			},
+		})
+	}
+	for _, name := range enabledDerivedTracks() {
+		tracks = append(tracks, scoreTrack{
+			track:   database.GetTrack(name),
+			accepts: derivedTracks[name],
+		})
+	}
+	// Each game mode enabled with MODE_TRACKS, such as OneSaber, gets standings of its own
+	for _, mode := range configuredList("MODE_TRACKS") {
+		tracks = append(tracks, scoreTrack{
+			track: database.GetTrack(ModeTrackName(mode)),
+			accepts: func(ctx context.Context, incomingScore ScoreMessage) bool {
+				return strings.EqualFold(gameModeOf(ctx, incomingScore), mode)
+			},
+		})
+	}
+	return tracks
+}
+
+// Fetch an active track by name, returning nil if there is no such track
+func LookupTrack(name string) *database.Track {
+	for _, scoreTrack := range activeTracks() {
+		if scoreTrack.track.Name == name {
+			return scoreTrack.track
+		}
+	}
+	return nil
+}
+
+// Return the tracks the incoming score counts towards
+func tracksForScore(ctx context.Context, incomingScore ScoreMessage) []*database.Track {
+	var tracks []*database.Track
+	for _, scoreTrack := range activeTracks() {
+		if scoreTrack.accepts(ctx, incomingScore) {
+			tracks = append(tracks, scoreTrack.track)
+		}
+	}
+	return tracks
+}
+
+// Return every track that currently holds standings, regardless of any score
+func standingTracks() []*database.Track {
+	var tracks []*database.Track
+	for _, scoreTrack := range activeTracks() {
+		tracks = append(tracks, scoreTrack.track)
+	}
+	return tracks
+}
+
+// Return whether the score would count towards the provided track
+func trackAccepts(ctx context.Context, track *database.Track, incomingScore ScoreMessage) bool {
+	for _, scoreTrack := range activeTracks() {
+		if scoreTrack.track.Name == track.Name {
+			return scoreTrack.accepts(ctx, incomingScore)
+		}
+	}
+	return false
+}
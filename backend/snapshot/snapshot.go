@@ -0,0 +1,126 @@
+package snapshot
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"nonetaken.dev/medalsaber/config"
+	"nonetaken.dev/medalsaber/database"
+)
+
+// How many climbers and fallers are returned when comparing snapshots
+const movementLimit = 10
+
+// A player's change in rank between two snapshots
+type Movement struct {
+	PlayerId   string
+	FromRank   int
+	ToRank     int
+	FromMedals int
+	ToMedals   int
+}
+
+// Begin taking snapshots of the medal standings for every region
+//
+// Snapshots are taken every SNAPSHOT_INTERVAL (24h by default) until ctx is cancelled, set it to 0 to disable them
+func Initialise(ctx context.Context) {
+	interval := config.GetDuration("SNAPSHOT_INTERVAL", 24*time.Hour)
+	// Snapshots are kept in MongoDB
+	if interval <= 0 || !database.MongoEnabled() {
+		return
+	}
+	go func() {
+		// Take a snapshot straight away if the last one is overdue
+		latest, err := database.GetLatestSnapshotTimestamp(ctx)
+		if err != nil {
+			log.Printf("error when getting the latest snapshot: %s\n", err)
+		} else if time.Since(time.UnixMilli(latest)) >= interval {
+			takeSnapshots(ctx)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				takeSnapshots(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Snapshot the current lifetime standings of every platform and region
+func takeSnapshots(ctx context.Context) {
+	players, err := database.GetTrackStandings(ctx, database.Lifetime)
+	if err != nil {
+		log.Printf("error when getting standings for snapshot: %s\n", err)
+		return
+	}
+	ranks := database.RankStandings(players)
+	timestamp := time.Now().UnixMilli()
+	var snapshots []any
+	for i, player := range players {
+		// Start a new snapshot for each platform and region
+		if i == 0 || player.Platform != players[i-1].Platform || player.Region != players[i-1].Region {
+			snapshots = append(snapshots, &database.Snapshot{
+				Platform:  player.Platform,
+				Region:    player.Region,
+				Timestamp: timestamp,
+			})
+		}
+		snapshot := snapshots[len(snapshots)-1].(*database.Snapshot)
+		snapshot.Entries = append(snapshot.Entries, database.SnapshotEntry{
+			PlayerId: player.PlayerId,
+			Rank:     ranks[i],
+			Medals:   player.Medals,
+		})
+	}
+	if len(snapshots) == 0 {
+		return
+	}
+	if err = database.InsertManyDocuments(ctx, database.Collections.Snapshots, snapshots); err != nil {
+		log.Printf("error when inserting snapshots: %s\n", err)
+		return
+	}
+	log.Printf("snapshotted the standings of %d regions", len(snapshots))
+}
+
+// Compare two snapshots of a region, returning the players who climbed and fell the most
+//
+// Only players present in both snapshots are compared
+func CompareSnapshots(from database.Snapshot, to database.Snapshot) ([]Movement, []Movement) {
+	previous := make(map[string]database.SnapshotEntry, len(from.Entries))
+	for _, entry := range from.Entries {
+		previous[entry.PlayerId] = entry
+	}
+	var climbers, fallers []Movement
+	for _, entry := range to.Entries {
+		previousEntry, ok := previous[entry.PlayerId]
+		if !ok || previousEntry.Rank == entry.Rank {
+			continue
+		}
+		movement := Movement{
+			PlayerId:   entry.PlayerId,
+			FromRank:   previousEntry.Rank,
+			ToRank:     entry.Rank,
+			FromMedals: previousEntry.Medals,
+			ToMedals:   entry.Medals,
+		}
+		if entry.Rank < previousEntry.Rank {
+			climbers = append(climbers, movement)
+		} else {
+			fallers = append(fallers, movement)
+		}
+	}
+	// Biggest movements first
+	sort.SliceStable(climbers, func(i, j int) bool {
+		return climbers[i].FromRank-climbers[i].ToRank > climbers[j].FromRank-climbers[j].ToRank
+	})
+	sort.SliceStable(fallers, func(i, j int) bool {
+		return fallers[i].ToRank-fallers[i].FromRank > fallers[j].ToRank-fallers[j].FromRank
+	})
+	return climbers[:min(len(climbers), movementLimit)], fallers[:min(len(fallers), movementLimit)]
+}
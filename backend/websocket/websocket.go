@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -8,31 +9,32 @@ import (
 	"nonetaken.dev/medalsaber/score"
 )
 
-func Initialise() {
+// Connect to each platform's score feed, handling scores until ctx is cancelled
+func Initialise(ctx context.Context) {
 	// Initialise ScoreSaber
 	go func() {
-		initSocket("wss://scoresaber.com/ws", func(message []byte) {
-			score.HandleScore(score.ScoresaberPlatform, message)
+		initSocket(ctx, "wss://scoresaber.com/ws", func(message []byte) {
+			score.HandleScore(ctx, score.ScoresaberPlatform, message)
 		})
-		fmt.Println("Connected to ScoreSaber")
+		fmt.Println("Disconnected from ScoreSaber")
 	}()
 	go func() {
 		// Initialise BeatLeader
-		initSocket("wss://sockets.api.beatleader.com/scores", func(message []byte) {
-			score.HandleScore(score.BeatleaderPlatform, message)
+		initSocket(ctx, "wss://sockets.api.beatleader.com/scores", func(message []byte) {
+			score.HandleScore(ctx, score.BeatleaderPlatform, message)
 		})
-		fmt.Println("Connected to BeatLeader")
+		fmt.Println("Disconnected from BeatLeader")
 	}()
 }
 
-func initSocket(url string, callback func(message []byte)) {
-	for {
+func initSocket(ctx context.Context, url string, callback func(message []byte)) {
+	for ctx.Err() == nil {
 		// Connect to the socket
-		c, _, err := websocket.DefaultDialer.Dial(url, nil)
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
 		if err != nil {
 			fmt.Printf("Error connecting to socket %s: %v\n", url, err)
 			// Wait before retrying
-			time.Sleep(5 * time.Second)
+			waitToReconnect(ctx)
 			continue
 		}
 
@@ -40,6 +42,8 @@ func initSocket(url string, callback func(message []byte)) {
 
 		// Close the socket when the function returns
 		defer c.Close()
+		// Close the socket on shutdown too, so the read below stops waiting
+		stopClosing := context.AfterFunc(ctx, func() { c.Close() })
 
 		// Read messages from the server
 		for {
@@ -50,9 +54,21 @@ func initSocket(url string, callback func(message []byte)) {
 			}
 			callback(message)
 		}
+		stopClosing()
+		if ctx.Err() != nil {
+			return
+		}
 		fmt.Printf("Connection lost to %s, reconnecting...\n", url)
 
 		// Wait before reconnecting
-		time.Sleep(5 * time.Second)
+		waitToReconnect(ctx)
+	}
+}
+
+// Wait before reconnecting to a socket, returning early on shutdown
+func waitToReconnect(ctx context.Context) {
+	select {
+	case <-time.After(5 * time.Second):
+	case <-ctx.Done():
 	}
 }